@@ -0,0 +1,228 @@
+package xmlrpc
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Assign stores a value produced by Unmarshal (bool, int, float64,
+// string, time.Time, []interface{}, map[string]interface{} or nil) into
+// the Go value pointed to by dst.
+//
+// Numbers are converted between integer and floating point kinds when
+// no precision is lost, arrays fill slices and fixed-size arrays, and
+// structs fill struct fields matched by name (exact match first, then
+// case-insensitive). Maps may have string, integer or
+// encoding.TextUnmarshaler keys, parsed from the member names. Pointers
+// are allocated as needed.
+func Assign(dst interface{}, src interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("Assign needs a non-nil pointer, got %T", dst)
+	}
+	return assignValue(dv.Elem(), src)
+}
+
+func assignError(dv reflect.Value, src interface{}) error {
+	return fmt.Errorf("Cannot assign %v <%T> to %v", src, src, dv.Type())
+}
+
+// store src into dv, which must be settable
+func assignValue(dv reflect.Value, src interface{}) error {
+	if src == nil {
+		dv.Set(reflect.Zero(dv.Type()))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if dv.Kind() == reflect.Ptr {
+		if dv.IsNil() {
+			dv.Set(reflect.New(dv.Type().Elem()))
+		}
+		return assignValue(dv.Elem(), src)
+	}
+	if sv.Type().AssignableTo(dv.Type()) {
+		dv.Set(sv)
+		return nil
+	}
+
+	switch dv.Kind() {
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dv.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch v := src.(type) {
+		case int:
+			i = int64(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return assignError(dv, src)
+			}
+			i = int64(v)
+		default:
+			return assignError(dv, src)
+		}
+		if dv.OverflowInt(i) {
+			return fmt.Errorf("Value %d overflows %v", i, dv.Type())
+		}
+		dv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch v := src.(type) {
+		case int:
+			if v < 0 {
+				return fmt.Errorf("Value %d overflows %v", v, dv.Type())
+			}
+			u = uint64(v)
+		case float64:
+			if v < 0 || v != math.Trunc(v) {
+				return assignError(dv, src)
+			}
+			u = uint64(v)
+		default:
+			return assignError(dv, src)
+		}
+		if dv.OverflowUint(u) {
+			return fmt.Errorf("Value %d overflows %v", u, dv.Type())
+		}
+		dv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch v := src.(type) {
+		case int:
+			dv.SetFloat(float64(v))
+			return nil
+		case float64:
+			dv.SetFloat(v)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := src.(string); ok {
+			dv.SetString(s)
+			return nil
+		}
+	case reflect.Slice:
+		if arr, ok := src.([]interface{}); ok {
+			s := reflect.MakeSlice(dv.Type(), len(arr), len(arr))
+			for i, a := range arr {
+				if err := assignValue(s.Index(i), a); err != nil {
+					return err
+				}
+			}
+			dv.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if arr, ok := src.([]interface{}); ok {
+			if len(arr) != dv.Len() {
+				return fmt.Errorf("Cannot assign %d items to %v",
+					len(arr), dv.Type())
+			}
+			for i, a := range arr {
+				if err := assignValue(dv.Index(i), a); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if m, ok := src.(map[string]interface{}); ok {
+			return assignMap(dv, m)
+		}
+	case reflect.Struct:
+		if m, ok := src.(map[string]interface{}); ok {
+			return assignStruct(dv, m)
+		}
+	case reflect.Interface:
+		if sv.Type().Implements(dv.Type()) {
+			dv.Set(sv)
+			return nil
+		}
+	}
+
+	return assignError(dv, src)
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// parse a member name back into a map key of type kt, the reverse of
+// mapKeyName
+func parseMapKey(name string, kt reflect.Type) (reflect.Value, error) {
+	if reflect.PtrTo(kt).Implements(textUnmarshalerType) {
+		kv := reflect.New(kt)
+		err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name))
+		return kv.Elem(), err
+	}
+
+	kv := reflect.New(kt).Elem()
+	switch kt.Kind() {
+	case reflect.String:
+		kv.SetString(name)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, kt.Bits())
+		if err != nil {
+			return kv, fmt.Errorf("Bad %v map key %q", kt, name)
+		}
+		kv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, kt.Bits())
+		if err != nil {
+			return kv, fmt.Errorf("Bad %v map key %q", kt, name)
+		}
+		kv.SetUint(u)
+	default:
+		return kv, fmt.Errorf("Unsupported map key type %v", kt)
+	}
+	return kv, nil
+}
+
+// fill a map from an XML-RPC <struct>
+func assignMap(dv reflect.Value, m map[string]interface{}) error {
+	kt := dv.Type().Key()
+	if dv.IsNil() {
+		dv.Set(reflect.MakeMapWithSize(dv.Type(), len(m)))
+	}
+	for k, v := range m {
+		kv, err := parseMapKey(k, kt)
+		if err != nil {
+			return err
+		}
+		ev := reflect.New(dv.Type().Elem()).Elem()
+		if err := assignValue(ev, v); err != nil {
+			return err
+		}
+		dv.SetMapIndex(kv, ev)
+	}
+	return nil
+}
+
+// fill a Go struct from an XML-RPC <struct>, members without a matching
+// exported field are ignored
+func assignStruct(dv reflect.Value, m map[string]interface{}) error {
+	st := dv.Type()
+	for k, v := range m {
+		f, ok := st.FieldByName(k)
+		if !ok || f.PkgPath != "" {
+			f, ok = st.FieldByNameFunc(func(n string) bool {
+				return strings.EqualFold(n, k)
+			})
+		}
+		if !ok || f.PkgPath != "" || len(f.Index) != 1 {
+			continue
+		}
+		if err := assignValue(dv.Field(f.Index[0]), v); err != nil {
+			return fmt.Errorf("Member %s: %v", k, err)
+		}
+	}
+	return nil
+}
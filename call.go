@@ -0,0 +1,110 @@
+package xmlrpc
+
+import (
+	"context"
+	"time"
+)
+
+// Call represents an asynchronous XML-RPC call started by Client.Go,
+// modeled on net/rpc.Call
+type Call struct {
+	ServiceMethod string        // name of the remote procedure
+	Args          []interface{} // parameters sent to the procedure
+	Reply         interface{}   // pointer filled with the result, may be nil
+	Result        interface{}   // the decoded result, as returned by RPCCall
+	Error         error         // transport error, or the *Fault from the server
+	Elapsed       time.Duration // time from sending the request to the reply
+	Done          chan *Call    // receives the Call when it is complete
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+		// the caller gave a done channel without enough buffer space,
+		// drop the notification like net/rpc does
+	}
+}
+
+// limit the number of calls made through Go which are in flight at the
+// same time, n <= 0 removes the limit
+//
+// Calls already started keep the limit they were started with
+func (c *Client) SetMaxInFlight(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n <= 0 {
+		c.sem = nil
+	} else {
+		c.sem = make(chan struct{}, n)
+	}
+}
+
+// Go invokes the procedure asynchronously. It returns the Call structure
+// representing the invocation, which is sent on done once the call has
+// completed. If done is nil, Go allocates a new channel, otherwise done
+// must be buffered or Go will panic.
+//
+// When reply is not nil the result is stored into it with Assign.
+func (c *Client) Go(methodName string, args []interface{}, reply interface{},
+	done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 10)
+	} else if cap(done) == 0 {
+		panic("xmlrpc: done channel is unbuffered")
+	}
+
+	call := &Call{ServiceMethod: methodName, Args: args, Reply: reply,
+		Done: done}
+
+	c.mu.Lock()
+	sem := c.sem
+	c.mu.Unlock()
+
+	go func() {
+		if sem != nil {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+		}
+
+		start := time.Now()
+		result, err, fault := c.RPCCall(methodName, args...)
+		call.Elapsed = time.Since(start)
+
+		if err == nil && fault == nil {
+			call.Result = result
+		}
+		call.Error = assignResult(reply, result, err, fault)
+		call.done()
+	}()
+
+	return call
+}
+
+// Call calls a procedure and stores its result into reply with Assign,
+// a fault is returned as the error. reply may be nil.
+func (c *Client) Call(methodName string, reply interface{},
+	args ...interface{}) error {
+	return c.CallContext(context.Background(), methodName, reply, args...)
+}
+
+// CallContext is Call with the context of RPCCallContext
+func (c *Client) CallContext(ctx context.Context, methodName string,
+	reply interface{}, args ...interface{}) error {
+	result, err, fault := c.RPCCallContext(ctx, methodName, args...)
+	return assignResult(reply, result, err, fault)
+}
+
+func assignResult(reply, result interface{}, err error, fault *Fault) error {
+	if err != nil {
+		return err
+	} else if fault != nil {
+		return fault
+	} else if reply == nil {
+		return nil
+	}
+	if params, ok := result.([]interface{}); ok {
+		result = extractParams(params)
+	}
+	return Assign(reply, result)
+}
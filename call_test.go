@@ -0,0 +1,150 @@
+package xmlrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientGo(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxSeen := 0, 0
+
+	h := NewHandler()
+	h.RegFunc(func(a, b int) int {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxSeen {
+			maxSeen = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return a + b
+	}, "add", nil)
+	h.RegFunc(func() *Fault { return NewFault(7, "boom") }, "fail", nil)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxInFlight(2)
+
+	done := make(chan *Call, 8)
+	replies := make([]int, 8)
+	for i := 0; i < 8; i++ {
+		c.Go("add", []interface{}{i, 100}, &replies[i], done)
+	}
+	for i := 0; i < 8; i++ {
+		call := <-done
+		if call.Error != nil {
+			t.Fatalf("call %v failed: %v", call.Args, call.Error)
+		}
+		if call.Elapsed <= 0 {
+			t.Errorf("call %v has no elapsed time", call.Args)
+		}
+	}
+	for i, r := range replies {
+		if r != i+100 {
+			t.Errorf("reply #%d = %d, expect %d", i, r, i+100)
+		}
+	}
+	if maxSeen > 2 {
+		t.Errorf("saw %d calls in flight, limit is 2", maxSeen)
+	}
+
+	call := <-c.Go("fail", nil, nil, nil).Done
+	if f, ok := call.Error.(*Fault); !ok || f.Code != 7 {
+		t.Errorf("expect fault 7, got %v", call.Error)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	type item struct {
+		Name  string
+		Price float64
+		Tags  []string
+		Next  *item
+	}
+	var it item
+	src := map[string]interface{}{
+		"name": "pen", "Price": 2, "Tags": []interface{}{"a", "b"},
+		"Next": map[string]interface{}{"Name": "ink"},
+	}
+	if err := Assign(&it, src); err != nil {
+		t.Fatal(err)
+	}
+	if it.Name != "pen" || it.Price != 2 || len(it.Tags) != 2 ||
+		it.Next == nil || it.Next.Name != "ink" {
+		t.Errorf("bad assign result %+v", it)
+	}
+
+	var i8 int8
+	if err := Assign(&i8, 300); err == nil {
+		t.Errorf("expect overflow error")
+	}
+	var s string
+	if err := Assign(&s, 1); err == nil {
+		t.Errorf("expect type error")
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(a, b int) interface{} {
+		if b == 0 {
+			return ErrorFault(errors.New("division by zero"))
+		}
+		return a / b
+	}, "div", nil)
+	h.RegFunc(func() *Fault {
+		return ErrorFault(fmt.Errorf("wrapped: %w", NewFault(7, "boom")))
+	}, "fail", nil)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var q int
+	if err := c.Call("div", &q, 7, 2); err != nil || q != 3 {
+		t.Errorf("got %d, %v", q, err)
+	}
+	err = c.Call("div", &q, 7, 0)
+	if f, ok := err.(*Fault); !ok || f.Code != errApplication ||
+		f.Msg != "division by zero" {
+		t.Errorf("got %v", err)
+	}
+	err = c.Call("fail", nil)
+	if f, ok := err.(*Fault); !ok || f.Code != 7 {
+		t.Errorf("got %v", err)
+	}
+}
+
+// a Handler sends the results of a method as they are, a trailing nil
+// error included; ErrorFault is for methods which want a fault
+func TestHandlerErrorResult(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() (int, error) { return 1, nil }, "one", nil)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err, f := c.RPCCall("one")
+	if err != nil || f != nil ||
+		!reflect.DeepEqual(res, []interface{}{1, nil}) {
+		t.Errorf("got %#v, %v, %v", res, err, f)
+	}
+}
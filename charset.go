@@ -0,0 +1,169 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Character sets other than UTF-8. Documents declaring ISO-8859-1 or
+// Windows-1252 are decoded by default, other charsets can be plugged in
+// through Decoder.CharsetReader, for example with
+// golang.org/x/net/html/charset.NewReaderLabel.
+
+// the characters Windows-1252 has in place of the C1 controls, 0 where
+// the byte is undefined
+var cp1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// a single byte charset
+type charset struct {
+	decode func(b byte) rune
+	encode func(r rune) (byte, bool)
+}
+
+var latin1 = &charset{
+	decode: func(b byte) rune { return rune(b) },
+	encode: func(r rune) (byte, bool) { return byte(r), r < 0x100 },
+}
+
+var windows1252 = &charset{
+	decode: func(b byte) rune {
+		if b >= 0x80 && b < 0xA0 && cp1252[b-0x80] != 0 {
+			return cp1252[b-0x80]
+		}
+		return rune(b)
+	},
+	encode: func(r rune) (byte, bool) {
+		if r < 0x80 || (r >= 0xA0 && r < 0x100) {
+			return byte(r), true
+		}
+		for i, c := range cp1252 {
+			if c == r {
+				return byte(0x80 + i), true
+			}
+		}
+		return 0, false
+	},
+}
+
+func lookupCharset(label string) *charset {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1",
+		"iso-ir-100", "cp819":
+		return latin1
+	case "windows-1252", "cp1252", "x-cp1252":
+		return windows1252
+	}
+	return nil
+}
+
+func isUTF8(label string) bool {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "", "utf-8", "utf8":
+		return true
+	}
+	return false
+}
+
+// CharsetReader converts input in the ISO-8859-1 or Windows-1252 charset
+// to UTF-8, it is the default Decoder.CharsetReader
+func CharsetReader(label string, input io.Reader) (io.Reader, error) {
+	cs := lookupCharset(label)
+	if cs == nil {
+		return nil, fmt.Errorf("Unsupported charset %q", label)
+	}
+	return &charsetReader{r: bufio.NewReader(input), cs: cs}, nil
+}
+
+type charsetReader struct {
+	r   *bufio.Reader
+	cs  *charset
+	buf []byte // converted bytes which did not fit in the last Read
+}
+
+func (cr *charsetReader) Read(p []byte) (int, error) {
+	for len(cr.buf) < len(p) {
+		// only wait for the first byte, a stream which stays open may
+		// not send more for a while
+		if len(cr.buf) > 0 && cr.r.Buffered() == 0 {
+			break
+		}
+		b, err := cr.r.ReadByte()
+		if err != nil {
+			if len(cr.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		cr.buf = utf8.AppendRune(cr.buf, cr.cs.decode(b))
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// converts UTF-8 to a single byte charset, the characters it does not
+// have are written as character references
+type charsetWriter struct {
+	w       io.Writer
+	cs      *charset
+	partial []byte // start of a rune split between two Writes
+}
+
+func (cw *charsetWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(cw.partial) > 0 {
+		p = append(cw.partial, p...)
+		cw.partial = nil
+	}
+
+	out := make([]byte, 0, len(p))
+	for len(p) > 0 {
+		if !utf8.FullRune(p) {
+			cw.partial = append([]byte(nil), p...)
+			break
+		}
+		r, size := utf8.DecodeRune(p)
+		p = p[size:]
+		if b, ok := cw.cs.encode(r); ok {
+			out = append(out, b)
+		} else {
+			out = append(out, fmt.Sprintf("&#%d;", r)...)
+		}
+	}
+	if _, err := cw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Flush fails when the last Write ended inside a rune, which is then
+// dropped
+func (cw *charsetWriter) Flush() error {
+	if len(cw.partial) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("Incomplete UTF-8 sequence %q at the end", cw.partial)
+	cw.partial = nil
+	return err
+}
+
+// the writer converting to the charset of e, out itself for UTF-8 or a
+// charset which is not supported
+func (e *Encoder) charsetWriter(out io.Writer) (*charsetWriter, bool) {
+	if e == nil || isUTF8(e.Charset) {
+		return nil, false
+	}
+	cs := lookupCharset(e.Charset)
+	if cs == nil {
+		return nil, false
+	}
+	return &charsetWriter{w: out, cs: cs}, true
+}
@@ -0,0 +1,163 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestUnmarshalCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		text    string
+		exp     string
+	}{
+		{"ISO-8859-1", "caf\xe9 \x80", "café \u0080"},
+		{"windows-1252", "caf\xe9 \x80 \x93q\x94", "café € “q”"},
+		{"latin1", "\xff", "ÿ"},
+	}
+	for _, tt := range tests {
+		doc := `<?xml version="1.0" encoding="` + tt.charset + `"?>
+<methodResponse><params><param><value><string>` + tt.text +
+			`</string></value></param></params></methodResponse>`
+
+		_, params, err, _ := UnmarshalString(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.charset, err)
+		}
+		if s := params.([]interface{})[0]; s != tt.exp {
+			t.Errorf("%s: got %q, expected %q", tt.charset, s, tt.exp)
+		}
+
+		m, err := UnmarshalValue(iotest.OneByteReader(strings.NewReader(doc)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.charset, err)
+		}
+		if s, _ := m.Params[0].Str(); s != tt.exp {
+			t.Errorf("%s: got %q, expected %q", tt.charset, s, tt.exp)
+		}
+	}
+
+	if _, _, err, _ := UnmarshalString(`<?xml version="1.0" encoding="koi8-r"?>` +
+		`<methodResponse></methodResponse>`); err == nil {
+		t.Error("koi8-r should not be supported")
+	}
+}
+
+// a stream which stays open, as a connection does
+func TestCharsetReaderStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>` +
+		"<methodCall><methodName>m</methodName><params><param><value>caf\xe9" +
+		"</value></param></params></methodCall>"))
+
+	done := make(chan *Message)
+	go func() {
+		m, err := NewDecoder(pr).DecodeMessage()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- m
+	}()
+	select {
+	case m := <-done:
+		if m == nil {
+			return
+		}
+		if s, _ := m.Params[0].Str(); s != "café" {
+			t.Errorf("got %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not decoded before more input")
+	}
+}
+
+func TestDecoderCharsetReader(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`<?xml version="1.0" encoding="shouty"?>` +
+		`<methodCall><methodName>m</methodName><params><param><value>abc</value>` +
+		`</param></params></methodCall>`))
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if charset != "shouty" {
+			return nil, errors.New("not shouty")
+		}
+		b, err := io.ReadAll(input)
+		return bytes.NewReader(bytes.Replace(b, []byte("abc"), []byte("ABC"), -1)), err
+	}
+	m, err := d.DecodeMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Params[0].Str(); s != "ABC" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestEncoderCharset(t *testing.T) {
+	e := &Encoder{Format: FormatCanonical, Charset: "windows-1252"}
+	buf := bytes.NewBufferString("")
+	if err := e.Marshal(buf, "m", "café € ☃", map[string]int{"ü": 1}); err != nil {
+		t.Fatal(err)
+	}
+	exp := `<?xml version="1.0" encoding="windows-1252"?><methodCall>` +
+		`<methodName>m</methodName><params>` +
+		"<param><value><string>caf\xe9 \x80 &#9731;</string></value></param>" +
+		"<param><value><struct><member><name>\xfc</name><value><int>1</int>" +
+		`</value></member></struct></value></param></params></methodCall>`
+	if buf.String() != exp {
+		t.Errorf("got\n%q\nexpected\n%q", buf.String(), exp)
+	}
+
+	_, params, err, _ := Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := params.([]interface{})[0]; s != "café € ☃" {
+		t.Errorf("got back %q", s)
+	}
+
+	// a rune split between writes
+	out := bytes.NewBufferString("")
+	cw := &charsetWriter{w: out, cs: latin1}
+	cw.Write([]byte("\xc3"))
+	cw.Write([]byte("\xa9"))
+	if out.String() != "\xe9" || cw.Flush() != nil {
+		t.Errorf("got %q", out.String())
+	}
+	cw.Write([]byte("x\xe2\x82"))
+	if err := cw.Flush(); err == nil || out.String() != "\xe9x" {
+		t.Errorf("dangling rune gave %q, %v", out.String(), err)
+	}
+
+	if err := (&Encoder{Charset: "koi8-r"}).Marshal(buf, "m"); err == nil {
+		t.Error("koi8-r should not be supported")
+	}
+}
+
+func TestHandlerCharsetFault(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() *Fault { return NewFault(7, "café €") }, "fail", nil)
+	h.SetEncoder(&Encoder{Charset: "ISO-8859-1"})
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("POST", "/",
+		strings.NewReader("<methodCall><methodName>fail</methodName><params/></methodCall>")))
+	body := resp.Body.String()
+	if ct := resp.Header().Get("Content-Type"); ct != "text/xml; charset=ISO-8859-1" {
+		t.Errorf("Content-Type is %q", ct)
+	}
+	if !strings.HasPrefix(body, `<?xml version="1.0" encoding="ISO-8859-1"?>`) ||
+		!strings.Contains(body, "caf\xe9 &#8364;") {
+		t.Errorf("got %q", body)
+	}
+
+	_, _, err, f := Unmarshal(strings.NewReader(body))
+	if err != nil || f == nil || f.Code != 7 || f.Msg != "café €" {
+		t.Errorf("got back %v, %v", err, f)
+	}
+}
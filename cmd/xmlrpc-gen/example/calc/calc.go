@@ -0,0 +1,18 @@
+// Package calc is an example for xmlrpc-gen, which made calc_xmlrpc.go
+package calc
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate go run xmlrpc/cmd/xmlrpc-gen -type Calc -prefix calc. calc.go
+
+// Calc is served over XML-RPC
+type Calc interface {
+	Add(ctx context.Context, a, b int) (int, error)
+	Sum(xs ...float64) (float64, error)
+	// xmlrpc:name calc.now
+	Now() (time.Time, error)
+	Reset(ctx context.Context) error
+}
@@ -0,0 +1,68 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xmlrpc"
+)
+
+type calc struct {
+	resets int
+}
+
+func (c *calc) Add(ctx context.Context, a, b int) (int, error) {
+	return a + b, nil
+}
+
+func (c *calc) Sum(xs ...float64) (float64, error) {
+	s := 0.0
+	for _, x := range xs {
+		s += x
+	}
+	return s, nil
+}
+
+func (c *calc) Now() (time.Time, error) {
+	return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), nil
+}
+
+func (c *calc) Reset(ctx context.Context) error {
+	c.resets++
+	if c.resets > 1 {
+		return errors.New("already reset")
+	}
+	return nil
+}
+
+func TestGenerated(t *testing.T) {
+	h := xmlrpc.NewHandler()
+	RegisterCalc(h, &calc{})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	xc, err := xmlrpc.NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Calc = &CalcClient{Client: xc}
+
+	ctx := context.Background()
+	if n, err := c.Add(ctx, 2, 3); n != 5 || err != nil {
+		t.Errorf("Add: %d, %v", n, err)
+	}
+	if x, err := c.Sum(1, 2.5); x != 3.5 || err != nil {
+		t.Errorf("Sum: %v, %v", x, err)
+	}
+	if now, err := c.Now(); now.Year() != 2024 || err != nil {
+		t.Errorf("Now: %v, %v", now, err)
+	}
+	if err := c.Reset(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := c.Reset(ctx); err == nil || err.Error() == "" {
+		t.Error("expected a fault")
+	}
+}
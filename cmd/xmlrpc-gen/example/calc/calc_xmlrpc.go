@@ -0,0 +1,78 @@
+// Code generated by xmlrpc-gen; DO NOT EDIT.
+
+package calc
+
+import (
+	"context"
+	"time"
+
+	"xmlrpc"
+)
+
+// CalcClient implements Calc by calling an XML-RPC server
+type CalcClient struct {
+	Client *xmlrpc.Client
+}
+
+var _ Calc = (*CalcClient)(nil)
+
+func (c *CalcClient) Add(ctx context.Context, a int, b int) (int, error) {
+	args := []interface{}{a, b}
+	var reply int
+	err := c.Client.CallContext(ctx, "calc.Add", &reply, args...)
+	return reply, err
+}
+
+func (c *CalcClient) Sum(xs ...float64) (float64, error) {
+	args := []interface{}{}
+	for _, v := range xs {
+		args = append(args, v)
+	}
+	var reply float64
+	err := c.Client.CallContext(context.Background(), "calc.Sum", &reply, args...)
+	return reply, err
+}
+
+func (c *CalcClient) Now() (time.Time, error) {
+	args := []interface{}{}
+	var reply time.Time
+	err := c.Client.CallContext(context.Background(), "calc.now", &reply, args...)
+	return reply, err
+}
+
+func (c *CalcClient) Reset(ctx context.Context) error {
+	args := []interface{}{}
+	return c.Client.CallContext(ctx, "calc.Reset", nil, args...)
+}
+
+// RegisterCalc registers the methods of impl on h under the names
+// CalcClient calls, errors are sent as faults
+func RegisterCalc(h *xmlrpc.Handler, impl Calc) {
+	h.RegFunc(func(ctx context.Context, a int, b int) interface{} {
+		reply, err := impl.Add(ctx, a, b)
+		if err != nil {
+			return xmlrpc.ErrorFault(err)
+		}
+		return reply
+	}, "calc.Add", nil)
+	h.RegFunc(func(xs ...float64) interface{} {
+		reply, err := impl.Sum(xs...)
+		if err != nil {
+			return xmlrpc.ErrorFault(err)
+		}
+		return reply
+	}, "calc.Sum", nil)
+	h.RegFunc(func() interface{} {
+		reply, err := impl.Now()
+		if err != nil {
+			return xmlrpc.ErrorFault(err)
+		}
+		return reply
+	}, "calc.now", nil)
+	h.RegFunc(func(ctx context.Context) *xmlrpc.Fault {
+		if err := impl.Reset(ctx); err != nil {
+			return xmlrpc.ErrorFault(err)
+		}
+		return nil
+	}, "calc.Reset", nil)
+}
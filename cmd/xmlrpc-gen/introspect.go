@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"xmlrpc"
+)
+
+// Stubs for servers with system.listMethods and system.methodSignature,
+// read from the server or from a dump saved with -save:
+//
+//	xmlrpc-gen -url https://bugzilla.example.com/xmlrpc.cgi -save api.json -pkg bugzilla -o bugzilla.go
+//	xmlrpc-gen -dump api.json -pkg bugzilla -o bugzilla.go
+
+// what introspection tells of a server
+type dump struct {
+	URL     string       `json:"url,omitempty"`
+	Methods []dumpMethod `json:"methods"`
+}
+
+type dumpMethod struct {
+	Name string `json:"name"`
+	// result type first, then the param types, as methodSignature
+	// returns them; none when the server does not know
+	Signatures [][]string `json:"signatures,omitempty"`
+	Help       string     `json:"help,omitempty"`
+}
+
+// query a server, url is only recorded in the dump
+func introspect(c *xmlrpc.Client, url string) (*dump, error) {
+	var names []string
+	if err := c.Call("system.listMethods", &names); err != nil {
+		return nil, fmt.Errorf("system.listMethods: %v", err)
+	}
+	sort.Strings(names)
+	d := &dump{URL: url}
+	for _, name := range names {
+		m := dumpMethod{Name: name}
+		// the signature is the string "undef" when unknown, or missing
+		// altogether, so only take what looks right
+		var sigs interface{}
+		if c.Call("system.methodSignature", &sigs, name) == nil {
+			m.Signatures = parseSignatures(sigs)
+		}
+		c.Call("system.methodHelp", &m.Help, name)
+		d.Methods = append(d.Methods, m)
+	}
+	return d, nil
+}
+
+func parseSignatures(v interface{}) [][]string {
+	list, _ := v.([]interface{})
+	var sigs [][]string
+	for _, s := range list {
+		types, _ := s.([]interface{})
+		var sig []string
+		for _, t := range types {
+			if name, ok := t.(string); ok {
+				sig = append(sig, name)
+			}
+		}
+		if len(sig) > 0 && len(sig) == len(types) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+func readDump(file string) (*dump, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d := &dump{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return d, nil
+}
+
+func writeDump(file string, d *dump) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// the Go type of an XML-RPC signature type, "" when unknown
+func goType(t string) string {
+	switch strings.ToLower(t) {
+	case "int", "i4", "i2", "i1":
+		return "int"
+	case "i8":
+		return "int64"
+	case "boolean":
+		return "bool"
+	case "string":
+		return "string"
+	case "double", "float":
+		return "float64"
+	case "datetime.iso8601", "datetime":
+		return "time.Time"
+	case "base64":
+		return "[]byte"
+	case "struct":
+		return "map[string]interface{}"
+	case "array":
+		return "[]interface{}"
+	case "nil", "void":
+		return "nil"
+	}
+	return ""
+}
+
+// a Go name for a method name, "Bug.get_all" is BugGetAll
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "M" + s
+	}
+	return s
+}
+
+// generate package pkg with a Client type which has one method per
+// method of d
+func generateStubs(d *dump, pkg, importPath string) ([]byte, error) {
+	var body bytes.Buffer
+	usesTime := false
+	seen := map[string]bool{"Client": true} // the field of Client
+	for _, m := range d.Methods {
+		name := goName(m.Name)
+		for i := 2; seen[name]; i++ {
+			name = fmt.Sprintf("%s%d", goName(m.Name), i)
+		}
+		seen[name] = true
+
+		fmt.Fprintf(&body, "\n// %s calls %s", name, m.Name)
+		if help := strings.TrimSpace(m.Help); help != "" {
+			fmt.Fprintf(&body, "\n//\n// %s", strings.ReplaceAll(help, "\n", "\n// "))
+		}
+		var sig []string
+		if len(m.Signatures) > 0 {
+			sig = m.Signatures[0]
+			for _, other := range m.Signatures[1:] {
+				fmt.Fprintf(&body, "\n//\n// Also %s", strings.Join(other, " "))
+			}
+		}
+		body.WriteString("\n")
+
+		params := []string{"ctx context.Context"}
+		var args []string
+		known := len(sig) > 0
+		var paramTypes []string
+		if known {
+			paramTypes = sig[1:]
+		}
+		for i, t := range paramTypes {
+			gt := goType(t)
+			if gt == "" || gt == "nil" {
+				known = false
+				break
+			}
+			params = append(params, fmt.Sprintf("p%d %s", i, gt))
+			args = append(args, fmt.Sprintf("p%d", i))
+		}
+		result := "interface{}"
+		if known && goType(sig[0]) != "" {
+			result = goType(sig[0])
+		}
+		if !known {
+			// nothing to go on
+			params, args = []string{"ctx context.Context", "args ...interface{}"}, nil
+			result = "interface{}"
+		}
+		usesTime = usesTime || strings.Contains(strings.Join(params, ",")+result, "time.")
+
+		argList := "args..."
+		if known {
+			argList = strings.Join(args, ", ")
+		}
+		if result == "nil" {
+			fmt.Fprintf(&body, "func (c *Client) %s(%s) error {\n", name,
+				strings.Join(params, ", "))
+			fmt.Fprintf(&body, "\treturn c.Client.CallContext(ctx, %q, nil", m.Name)
+		} else {
+			fmt.Fprintf(&body, "func (c *Client) %s(%s) (%s, error) {\n", name,
+				strings.Join(params, ", "), result)
+			fmt.Fprintf(&body, "\tvar reply %s\n\terr := c.Client.CallContext(ctx, %q, &reply",
+				result, m.Name)
+		}
+		if argList != "" {
+			fmt.Fprintf(&body, ", %s", argList)
+		}
+		body.WriteString(")\n")
+		if result != "nil" {
+			body.WriteString("\treturn reply, err\n")
+		}
+		body.WriteString("}\n")
+	}
+
+	var out bytes.Buffer
+	from := "introspection"
+	if d.URL != "" {
+		from = d.URL
+	}
+	fmt.Fprintf(&out, "// Code generated by xmlrpc-gen from %s; DO NOT EDIT.\n\n", from)
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"context\"\n", pkg)
+	if usesTime {
+		out.WriteString("\t\"time\"\n")
+	}
+	fmt.Fprintf(&out, "\n\t%q\n)\n", importPath)
+	out.WriteString("\n// Client calls the methods of the server\n")
+	out.WriteString("type Client struct {\n\tClient *xmlrpc.Client\n}\n")
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xmlrpc"
+)
+
+// a server with introspection, as Bugzilla has
+func introspectionServer() *xmlrpc.Handler {
+	sigs := map[string]interface{}{
+		"Bug.get":     []interface{}{[]interface{}{"struct", "struct"}},
+		"Bug.comment": []interface{}{[]interface{}{"int", "int", "string"}, []interface{}{"int", "string", "string"}},
+		"Bug.touch":   []interface{}{[]interface{}{"nil", "dateTime.iso8601"}},
+		"version":     "undef",
+	}
+	h := xmlrpc.NewHandler()
+	h.RegFunc(func() []string {
+		return []string{"version", "Bug.get", "Bug.comment", "Bug.touch"}
+	}, "system.listMethods", nil)
+	h.RegFunc(func(name string) interface{} { return sigs[name] },
+		"system.methodSignature", nil)
+	h.RegFunc(func(name string) string {
+		if name == "Bug.get" {
+			return "Gets bugs.\nBy id."
+		}
+		return ""
+	}, "system.methodHelp", nil)
+	return h
+}
+
+func TestIntrospect(t *testing.T) {
+	s := httptest.NewServer(introspectionServer())
+	defer s.Close()
+	c, err := xmlrpc.NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := introspect(c, "http://bugs/xmlrpc.cgi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a saved dump gives the same code
+	file := filepath.Join(t.TempDir(), "api.json")
+	if err := writeDump(file, d); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := readDump(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, saved) {
+		t.Errorf("got back %+v\nexpected %+v", saved, d)
+	}
+
+	src, err := generateStubs(saved, "bugzilla", "xmlrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		"// Code generated by xmlrpc-gen from http://bugs/xmlrpc.cgi; DO NOT EDIT.",
+		"package bugzilla",
+		"\t\"time\"\n",
+		"// BugGet calls Bug.get\n//\n// Gets bugs.\n// By id.\n",
+		"func (c *Client) BugGet(ctx context.Context, p0 map[string]interface{}) (map[string]interface{}, error) {",
+		"// Also int string string\n",
+		"func (c *Client) BugComment(ctx context.Context, p0 int, p1 string) (int, error) {",
+		`err := c.Client.CallContext(ctx, "Bug.comment", &reply, p0, p1)`,
+		"func (c *Client) BugTouch(ctx context.Context, p0 time.Time) error {",
+		"func (c *Client) Version(ctx context.Context, args ...interface{}) (interface{}, error) {",
+		`err := c.Client.CallContext(ctx, "version", &reply, args...)`,
+	} {
+		if !strings.Contains(string(src), part) {
+			t.Errorf("missing %s in\n%s", part, src)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, exp := range map[string]string{
+		"Bug.get_all":        "BugGetAll",
+		"system.listMethods": "SystemListMethods",
+		"2fa.check":          "M2faCheck",
+	} {
+		if got := goName(name); got != exp {
+			t.Errorf("%s: got %s, expected %s", name, got, exp)
+		}
+	}
+}
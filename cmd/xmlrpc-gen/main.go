@@ -0,0 +1,398 @@
+// Command xmlrpc-gen generates a typed XML-RPC client and a server
+// adapter for Go interfaces.
+//
+//	xmlrpc-gen -type Calc -prefix calc. calc.go
+//
+// writes calc_xmlrpc.go with a CalcClient, which implements Calc by
+// calling through an *xmlrpc.Client, and RegisterCalc, which registers an
+// implementation of Calc on an *xmlrpc.Handler under the same names,
+// sending the errors it returns as faults.
+//
+// Every method must return an error last, and at most one other result.
+// A first context.Context param is passed to Client.CallContext. The
+// XML-RPC name of a method is the prefix and the method name, unless its
+// doc comment has a line "xmlrpc:name other.name".
+//
+// With -url or -dump it generates instead a package with a typed method
+// per method of a server which supports introspection:
+//
+//	xmlrpc-gen -url http://host/RPC2 -save api.json -pkg api -o api.go
+//	xmlrpc-gen -dump api.json -pkg api -o api.go
+//
+// queries the server, saving what it said in api.json, and generates
+// api.go from it, the second form without the server.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"xmlrpc"
+)
+
+func main() {
+	types := flag.String("type", "", "comma separated interface names")
+	prefix := flag.String("prefix", "", "prefix of the XML-RPC method names")
+	imp := flag.String("import", "xmlrpc", "import path of the xmlrpc package")
+	out := flag.String("o", "", "output file, default <file>_xmlrpc.go")
+	url := flag.String("url", "", "introspect the server at this address")
+	dumpFile := flag.String("dump", "", "read the introspection of a server saved with -save")
+	save := flag.String("save", "", "save the introspection of -url in this file")
+	pkg := flag.String("pkg", "", "package of the code generated with -url or -dump")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: xmlrpc-gen -type T[,U] [flags] file.go\n")
+		fmt.Fprintf(os.Stderr, "       xmlrpc-gen -url URL|-dump file -pkg name [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *url != "" || *dumpFile != "" {
+		if flag.NArg() != 0 || *pkg == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := stubs(*url, *dumpFile, *save, *pkg, *imp, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "xmlrpc-gen: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.NArg() != 1 || *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file := flag.Arg(0)
+	src, err := os.ReadFile(file)
+	if err == nil {
+		src, err = generate(file, src, strings.Split(*types, ","), *prefix, *imp)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xmlrpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		*out = outputName(file)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "xmlrpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// a method of an interface
+type method struct {
+	name    string // Go name
+	rpcName string
+	params  []param
+	ctx     string // name of the context.Context param, "" when none
+	result  string // type of the result other than error, "" when none
+}
+
+type param struct {
+	name     string
+	typ      string
+	variadic bool
+}
+
+// names used by the generated methods, which params must not shadow
+var reserved = map[string]bool{"c": true, "reply": true, "err": true,
+	"args": true, "context": true, "xmlrpc": true, "h": true, "impl": true}
+
+// generate the client and server adapter of the interfaces named types
+// in the Go source src
+func generate(filename string, src []byte, types []string, prefix,
+	importPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool) // packages named in the signatures
+	var buf bytes.Buffer
+	for _, name := range types {
+		it := findInterface(f, name)
+		if it == nil {
+			return nil, fmt.Errorf("%s: no interface %s", filename, name)
+		}
+		var methods []method
+		for _, field := range it.Methods.List {
+			m, err := parseMethod(fset, field, prefix, used)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%v", fset.Position(field.Pos()),
+					name, err)
+			}
+			methods = append(methods, m)
+		}
+		writeClient(&buf, name, methods)
+		writeAdapter(&buf, name, methods)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by xmlrpc-gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"context\"\n", f.Name.Name)
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if used[name] && p != "context" && p != importPath {
+			if spec.Name != nil {
+				fmt.Fprintf(&out, "\t%s %q\n", name, p)
+			} else {
+				fmt.Fprintf(&out, "\t%q\n", p)
+			}
+		}
+	}
+	fmt.Fprintf(&out, "\n\t%q\n)\n", importPath)
+	out.Write(buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+func findInterface(f *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if it, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == name {
+				return it
+			}
+		}
+	}
+	return nil
+}
+
+func parseMethod(fset *token.FileSet, field *ast.Field, prefix string,
+	used map[string]bool) (method, error) {
+	if len(field.Names) == 0 {
+		return method{}, fmt.Errorf("%s: embedded interfaces are not supported",
+			exprString(fset, field.Type))
+	}
+	m := method{name: field.Names[0].Name}
+	m.rpcName = prefix + m.name
+	if field.Doc != nil {
+		for _, c := range field.Doc.List {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if strings.HasPrefix(text, "xmlrpc:name ") {
+				m.rpcName = strings.TrimSpace(strings.TrimPrefix(text, "xmlrpc:name "))
+			}
+		}
+	}
+	ft := field.Type.(*ast.FuncType)
+
+	ast.Inspect(ft, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	i := 0
+	for _, pf := range ft.Params.List {
+		typ := pf.Type
+		variadic := false
+		if el, ok := typ.(*ast.Ellipsis); ok {
+			typ, variadic = el.Elt, true
+		}
+		names := pf.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, id := range names {
+			name := fmt.Sprintf("p%d", i)
+			if id != nil && id.Name != "_" {
+				name = id.Name
+			}
+			if reserved[name] {
+				name += "_"
+			}
+			if i == 0 && exprString(fset, typ) == "context.Context" {
+				m.ctx = name
+			} else {
+				m.params = append(m.params, param{name: name,
+					typ: exprString(fset, typ), variadic: variadic})
+			}
+			i++
+		}
+	}
+
+	var results []string
+	if ft.Results != nil {
+		for _, rf := range ft.Results.List {
+			n := len(rf.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				results = append(results, exprString(fset, rf.Type))
+			}
+		}
+	}
+	if len(results) == 0 || results[len(results)-1] != "error" {
+		return m, fmt.Errorf("%s: the last result must be an error", m.name)
+	}
+	if len(results) > 2 {
+		return m, fmt.Errorf("%s: more than one result besides the error",
+			m.name)
+	}
+	if len(results) == 2 {
+		m.result = results[0]
+	}
+	return m, nil
+}
+
+func exprString(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, e)
+	return buf.String()
+}
+
+func writeClient(buf *bytes.Buffer, name string, methods []method) {
+	fmt.Fprintf(buf, "\n// %sClient implements %s by calling an XML-RPC server\n", name, name)
+	fmt.Fprintf(buf, "type %sClient struct {\n\tClient *xmlrpc.Client\n}\n", name)
+	fmt.Fprintf(buf, "\nvar _ %s = (*%sClient)(nil)\n", name, name)
+
+	for _, m := range methods {
+		var sig, args []string
+		if m.ctx != "" {
+			sig = append(sig, m.ctx+" context.Context")
+		}
+		var rest *param
+		for i, p := range m.params {
+			if p.variadic {
+				sig = append(sig, p.name+" ..."+p.typ)
+				rest = &m.params[i]
+			} else {
+				sig = append(sig, p.name+" "+p.typ)
+				args = append(args, p.name)
+			}
+		}
+		results := "error"
+		if m.result != "" {
+			results = "(" + m.result + ", error)"
+		}
+		fmt.Fprintf(buf, "\nfunc (c *%sClient) %s(%s) %s {\n", name, m.name,
+			strings.Join(sig, ", "), results)
+
+		ctx := m.ctx
+		if ctx == "" {
+			ctx = "context.Background()"
+		}
+		call := func(reply string) string {
+			return fmt.Sprintf("c.Client.CallContext(%s, %q, %s, args...)", ctx,
+				m.rpcName, reply)
+		}
+		fmt.Fprintf(buf, "\targs := []interface{}{%s}\n", strings.Join(args, ", "))
+		if rest != nil {
+			fmt.Fprintf(buf, "\tfor _, v := range %s {\n\t\targs = append(args, v)\n\t}\n",
+				rest.name)
+		}
+		if m.result == "" {
+			fmt.Fprintf(buf, "\treturn %s\n}\n", call("nil"))
+		} else {
+			fmt.Fprintf(buf, "\tvar reply %s\n\terr := %s\n\treturn reply, err\n}\n",
+				m.result, call("&reply"))
+		}
+	}
+}
+
+// the adapter registers a function per method which sends a non-nil
+// error as a fault, with xmlrpc.ErrorFault
+func writeAdapter(buf *bytes.Buffer, name string, methods []method) {
+	fmt.Fprintf(buf, "\n// Register%s registers the methods of impl on h under the names\n", name)
+	fmt.Fprintf(buf, "// %sClient calls, errors are sent as faults\n", name)
+	fmt.Fprintf(buf, "func Register%s(h *xmlrpc.Handler, impl %s) {\n", name, name)
+	for _, m := range methods {
+		var sig, args []string
+		if m.ctx != "" {
+			sig = append(sig, m.ctx+" context.Context")
+			args = append(args, m.ctx)
+		}
+		for _, p := range m.params {
+			if p.variadic {
+				sig = append(sig, p.name+" ..."+p.typ)
+				args = append(args, p.name+"...")
+			} else {
+				sig = append(sig, p.name+" "+p.typ)
+				args = append(args, p.name)
+			}
+		}
+		call := fmt.Sprintf("impl.%s(%s)", m.name, strings.Join(args, ", "))
+		if m.result == "" {
+			fmt.Fprintf(buf, "\th.RegFunc(func(%s) *xmlrpc.Fault {\n", strings.Join(sig, ", "))
+			fmt.Fprintf(buf, "\t\tif err := %s; err != nil {\n", call)
+			fmt.Fprintf(buf, "\t\t\treturn xmlrpc.ErrorFault(err)\n\t\t}\n")
+			fmt.Fprintf(buf, "\t\treturn nil\n")
+		} else {
+			fmt.Fprintf(buf, "\th.RegFunc(func(%s) interface{} {\n", strings.Join(sig, ", "))
+			fmt.Fprintf(buf, "\t\treply, err := %s\n", call)
+			fmt.Fprintf(buf, "\t\tif err != nil {\n\t\t\treturn xmlrpc.ErrorFault(err)\n\t\t}\n")
+			fmt.Fprintf(buf, "\t\treturn reply\n")
+		}
+		fmt.Fprintf(buf, "\t}, %q, nil)\n", m.rpcName)
+	}
+	fmt.Fprintf(buf, "}\n")
+}
+
+// the default output file of a source file
+func outputName(file string) string {
+	return filepath.Join(filepath.Dir(file),
+		strings.TrimSuffix(filepath.Base(file), ".go")+"_xmlrpc.go")
+}
+
+// generate stubs from the introspection of a server, to out or stdout
+func stubs(url, dumpFile, save, pkg, importPath, out string) error {
+	var d *dump
+	var err error
+	if url != "" {
+		c, err := xmlrpc.NewClient(url)
+		if err != nil {
+			return err
+		}
+		// keep passwords out of the dump and the generated code
+		if u, err := neturl.Parse(url); err == nil {
+			u.User = nil
+			url = u.String()
+		}
+		if d, err = introspect(c, url); err != nil {
+			return err
+		}
+		if save != "" {
+			if err := writeDump(save, d); err != nil {
+				return err
+			}
+		}
+	} else if d, err = readDump(dumpFile); err != nil {
+		return err
+	}
+
+	src, err := generateStubs(d, pkg, importPath)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0644)
+}
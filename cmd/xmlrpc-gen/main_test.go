@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// the example package must be regenerated when the generator changes
+func TestGenerateExample(t *testing.T) {
+	src, err := os.ReadFile("example/calc/calc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate("calc.go", src, []string{"Calc"}, "calc.", "xmlrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := os.ReadFile("example/calc/calc_xmlrpc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, exp) {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, tt := range []struct {
+		src string
+		err string
+	}{
+		{"type T interface{ M() int }", "last result must be an error"},
+		{"type T interface{ M() (a, b int, err error) }", "more than one result"},
+		{"type T interface{ io.Reader }", "embedded interfaces"},
+		{"type U interface{}", "no interface T"},
+	} {
+		_, err := generate("t.go", []byte("package p\n"+tt.src), []string{"T"},
+			"", "xmlrpc")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v", tt.src, err)
+		}
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	src := `package p
+import x "net/url"
+type T interface {
+	Get(c string, _ int, u *x.URL) error
+}`
+	got, err := generate("t.go", []byte(src), []string{"T"}, "", "example.com/xmlrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{`x "net/url"`, `"example.com/xmlrpc"`,
+		"Get(c_ string, p1 int, u *x.URL) error",
+		"args := []interface{}{c_, p1, u}"} {
+		if !strings.Contains(string(got), part) {
+			t.Errorf("missing %s in\n%s", part, got)
+		}
+	}
+}
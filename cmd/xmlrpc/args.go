@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"xmlrpc"
+)
+
+// the value of a command line argument, see the package doc for the syntax
+func parseArg(arg string) (interface{}, error) {
+	if strings.HasPrefix(arg, "@") {
+		b, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		return parseJSON(arg, b)
+	}
+
+	prefix, val, found := strings.Cut(arg, ":")
+	if !found {
+		return arg, nil
+	}
+	switch prefix {
+	case "i":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("bad int %q", arg)
+		}
+		return n, nil
+	case "d":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad double %q", arg)
+		}
+		return f, nil
+	case "b":
+		switch val {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("bad boolean %q", arg)
+	case "s":
+		return val, nil
+	case "t":
+		for _, layout := range []string{xmlrpc.ISO8601_LAYOUT, time.RFC3339} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("bad dateTime %q", arg)
+	case "b64":
+		if strings.HasPrefix(val, "@") {
+			return os.ReadFile(val[1:])
+		}
+		b, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, fmt.Errorf("bad base64 %q", arg)
+		}
+		return b, nil
+	case "json":
+		return parseJSON(arg, []byte(val))
+	case "nil":
+		return nil, nil
+	}
+	// such as a URL
+	return arg, nil
+}
+
+func parseJSON(arg string, b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("bad JSON in %q: %v", arg, err)
+	}
+	v, err := xmlrpc.FromJSONValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", arg, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,208 @@
+// Command xmlrpc calls XML-RPC servers from the command line.
+//
+//	xmlrpc call [-o xml|json|go] [-timeout 30s] URL method [arg...]
+//	xmlrpc list [-v] URL
+//
+// Arguments are typed by a prefix:
+//
+//	i:42          int
+//	d:3.5         double
+//	b:true        boolean, also 1 and 0
+//	s:text        string, which is also what an argument without a known
+//	              prefix is
+//	t:20240102T03:04:05
+//	              dateTime.iso8601, RFC 3339 is accepted too
+//	b64:aGk=      base64, given encoded
+//	b64:@file.bin base64 holding the bytes of a file
+//	json:[1,"a"]  any value, in the typed JSON notation of the xmlrpc
+//	              package, where {"$base64": "..."} is a base64
+//	@file.json    the same, read from a file
+//	nil:          nil
+//
+// list prints the methods of servers with introspection, with their
+// signatures and help when -v is given.
+//
+// The exit status is 0 on success, 1 when the server answers with a fault,
+// 2 for bad usage and 3 when the call fails otherwise, such as a network
+// error or a response which cannot be decoded.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"xmlrpc"
+)
+
+const (
+	exitOK        = 0
+	exitFault     = 1
+	exitUsage     = 2
+	exitTransport = 3
+)
+
+const usage = `usage: xmlrpc call [-o xml|json|go] [-timeout 30s] URL method [arg...]
+       xmlrpc list [-v] URL
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "call":
+		return call(args[1:], stdout, stderr)
+	case "list":
+		return list(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "xmlrpc: unknown command %q\n%s", args[0], usage)
+	return exitUsage
+}
+
+func call(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("o", "xml", "output format: xml, json or go")
+	timeout := fs.Duration("timeout", 30*time.Second, "time allowed for the call")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if *format != "xml" && *format != "json" && *format != "go" {
+		fmt.Fprintf(stderr, "xmlrpc: unknown output format %q\n", *format)
+		return exitUsage
+	}
+
+	params := make([]interface{}, 0, fs.NArg()-2)
+	for _, a := range fs.Args()[2:] {
+		v, err := parseArg(a)
+		if err != nil {
+			fmt.Fprintf(stderr, "xmlrpc: %v\n", err)
+			return exitUsage
+		}
+		params = append(params, v)
+	}
+
+	c, err := xmlrpc.NewClient(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "xmlrpc: %v\n", err)
+		return exitUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	result, err, fault := c.RPCCallContext(ctx, fs.Arg(1), params...)
+	if code := report(stderr, err, fault); code != exitOK {
+		return code
+	}
+
+	results, _ := result.([]interface{})
+	if err := printResult(stdout, *format, results); err != nil {
+		fmt.Fprintf(stderr, "xmlrpc: %v\n", err)
+		return exitTransport
+	}
+	return exitOK
+}
+
+// print why a call failed, returns the exit status
+func report(stderr io.Writer, err error, fault *xmlrpc.Fault) int {
+	if err != nil {
+		fmt.Fprintf(stderr, "xmlrpc: %v\n", err)
+		return exitTransport
+	}
+	if fault != nil {
+		fmt.Fprintf(stderr, "xmlrpc: fault %d: %s\n", fault.Code, fault.Msg)
+		return exitFault
+	}
+	return exitOK
+}
+
+func printResult(w io.Writer, format string, results []interface{}) error {
+	if format == "xml" {
+		e := &xmlrpc.Encoder{Format: xmlrpc.FormatPretty}
+		return e.Marshal(w, "", results...)
+	}
+
+	// a single result is shown alone, which is the usual case
+	var v interface{} = results
+	if len(results) == 1 {
+		v = results[0]
+	}
+	if format == "go" {
+		_, err := fmt.Fprintf(w, "%#v\n", v)
+		return err
+	}
+	jv, err := xmlrpc.ToJSONValue(v)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(jv, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func list(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	verbose := fs.Bool("v", false, "show signatures and help")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	c, err := xmlrpc.NewClient(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "xmlrpc: %v\n", err)
+		return exitUsage
+	}
+
+	var names []string
+	err = c.Call("system.listMethods", &names)
+	if f, ok := err.(*xmlrpc.Fault); ok {
+		return report(stderr, nil, f)
+	} else if code := report(stderr, err, nil); code != exitOK {
+		return code
+	}
+	for _, name := range names {
+		fmt.Fprintln(stdout, name)
+		if !*verbose {
+			continue
+		}
+		// servers may know the names only
+		var sigs [][]string
+		if c.Call("system.methodSignature", &sigs, name) == nil {
+			for _, sig := range sigs {
+				if len(sig) > 0 {
+					fmt.Fprintf(stdout, "    %s(%s) %s\n", name,
+						strings.Join(sig[1:], ", "), sig[0])
+				}
+			}
+		}
+		var help string
+		if c.Call("system.methodHelp", &help, name) == nil && help != "" {
+			fmt.Fprintf(stdout, "    %s\n", strings.ReplaceAll(help, "\n", "\n    "))
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"xmlrpc"
+)
+
+func TestParseArg(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "f.bin")
+	os.WriteFile(bin, []byte{0, 1, 2}, 0644)
+	js := filepath.Join(dir, "f.json")
+	os.WriteFile(js, []byte(`{"a": [1, 2.5, {"$base64": "aGk="}]}`), 0644)
+
+	for arg, exp := range map[string]interface{}{
+		"i:42":                   42,
+		"d:3.5":                  3.5,
+		"b:true":                 true,
+		"b:0":                    false,
+		"s:i:42":                 "i:42",
+		"plain":                  "plain",
+		"http://x/RPC2":          "http://x/RPC2",
+		"t:20240102T03:04:05":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"t:2024-01-02T03:04:05Z": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"b64:aGk=":               []byte("hi"),
+		"b64:@" + bin:            []byte{0, 1, 2},
+		"json:[1,\"a\"]":         []interface{}{1, "a"},
+		"@" + js: map[string]interface{}{
+			"a": []interface{}{1, 2.5, []byte("hi")}},
+		"nil:": nil,
+	} {
+		got, err := parseArg(arg)
+		if err != nil {
+			t.Errorf("%s: %v", arg, err)
+		} else if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: got %#v, expected %#v", arg, got, exp)
+		}
+	}
+
+	for _, arg := range []string{"i:x", "d:", "b:yes", "t:today", "b64:!",
+		"json:{", "@" + filepath.Join(dir, "missing")} {
+		if _, err := parseArg(arg); err == nil {
+			t.Errorf("%s should not parse", arg)
+		}
+	}
+}
+
+func testServer() *httptest.Server {
+	h := xmlrpc.NewHandler()
+	h.RegFunc(func(a, b int) int { return a + b }, "add", nil)
+	h.RegFunc(func(s string, b []byte) map[string]interface{} {
+		return map[string]interface{}{"s": s, "b": b}
+	}, "echo", nil)
+	h.RegFunc(func() []string { return []string{"add", "echo"} },
+		"system.listMethods", nil)
+	h.RegFunc(func(name string) [][]string {
+		return [][]string{{"int", "int", "int"}}
+	}, "system.methodSignature", nil)
+	return httptest.NewServer(h)
+}
+
+func TestRun(t *testing.T) {
+	s := testServer()
+	defer s.Close()
+
+	tests := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"call", "-o", "json", s.URL, "add", "i:1", "i:2"}, exitOK, "3\n"},
+		{[]string{"call", "-o", "go", s.URL, "add", "i:1", "i:2"}, exitOK, "3\n"},
+		{[]string{"call", "-o", "json", s.URL, "echo", "x", "b64:aGk="}, exitOK,
+			"{\n  \"b\": {\n    \"$base64\": \"aGk=\"\n  },\n  \"s\": \"x\"\n}\n"},
+		{[]string{"call", s.URL, "add", "i:1", "i:2"}, exitOK,
+			"<?xml version=\"1.0\"?>\n<methodResponse>\n  <params>\n    <param>\n" +
+				"      <value><int>3</int></value>\n    </param>\n" +
+				"  </params>\n</methodResponse>\n"},
+		{[]string{"list", s.URL}, exitOK, "add\necho\n"},
+		{[]string{"list", "-v", s.URL}, exitOK,
+			"add\n    add(int, int) int\necho\n    echo(int, int) int\n"},
+		{[]string{"call", s.URL, "add", "i:1"}, exitFault, ""},
+		{[]string{"call", s.URL, "add", "i:x"}, exitUsage, ""},
+		{[]string{"call", "-o", "yaml", s.URL, "add"}, exitUsage, ""},
+		{[]string{"call", s.URL}, exitUsage, ""},
+		{[]string{"frob"}, exitUsage, ""},
+		{[]string{"call", "http://127.0.0.1:1/RPC2", "add"}, exitTransport, ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, &stdout, &stderr)
+		if code != tt.code || stdout.String() != tt.out {
+			t.Errorf("%v: exit %d, expected %d, output\n%s%s", tt.args, code,
+				tt.code, stdout.String(), stderr.String())
+		}
+		if code == exitFault && !strings.Contains(stderr.String(), "fault -32602") {
+			t.Errorf("%v: got %s", tt.args, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Params can be given as the args of an rpc.Client call, or as the args
+// pointer of an rpc.Server method, to send or receive several XML-RPC
+// parameters instead of a single one
+type Params []interface{}
+
+// skip the white space between two XML documents on a stream, returns
+// io.EOF when the stream ends cleanly
+func skipSpace(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return r.UnreadByte()
+		}
+	}
+}
+
+// store the decoded parameters into an rpc args or reply pointer
+func assignParams(x interface{}, params []interface{}) error {
+	if x == nil {
+		return nil
+	}
+	if p, ok := x.(*Params); ok {
+		*p = params
+		return nil
+	}
+	switch len(params) {
+	case 0:
+		return nil
+	case 1:
+		return Assign(x, params[0])
+	}
+	return Assign(x, params)
+}
+
+// encode rpc args or reply as XML-RPC parameters
+func paramsOf(x interface{}) []interface{} {
+	switch v := x.(type) {
+	case nil:
+		return nil
+	case Params:
+		return v
+	case *Params:
+		return *v
+	}
+	// rpc passes the reply as a pointer
+	if v := reflect.ValueOf(x); v.Kind() == reflect.Ptr && !v.IsNil() {
+		x = v.Elem().Interface()
+	}
+	return []interface{}{x}
+}
+
+// ParseFault reads back the string of a Fault, "message (code#N)", which
+// is how faults travel through net/rpc. ok is false for other strings.
+func ParseFault(s string) (f *Fault, ok bool) {
+	i := strings.LastIndex(s, " (code#")
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		return nil, false
+	}
+	code, err := strconv.Atoi(s[i+len(" (code#") : len(s)-1])
+	if err != nil {
+		return nil, false
+	}
+	return &Fault{Code: code, Msg: s[:i]}, true
+}
+
+type serverCodec struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+
+	params []interface{}
+
+	mu      sync.Mutex
+	seq     uint64            // sequence number of the last request read
+	next    uint64            // sequence number of the next response to write
+	pending map[uint64][]byte // responses waiting for earlier ones
+}
+
+// NewServerCodec returns an rpc.ServerCodec which reads XML-RPC
+// <methodCall> documents from conn and writes <methodResponse> documents
+// back, one after the other, in the order the calls were received.
+//
+// The procedure name is used as the rpc ServiceMethod as is, so it must
+// have the "Service.Method" form rpc.Server expects.
+//
+// rpc.Server only passes on the string of an error. A method returning a
+// *Fault, whose string is "message (code#N)", sends a fault with that code
+// and message; any other error is a fault with the code -32603.
+func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{rwc: conn, r: bufio.NewReader(conn), next: 1,
+		pending: make(map[uint64][]byte)}
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := skipSpace(c.r); err != nil {
+		return err
+	}
+	methodName, params, err, fault := Unmarshal(c.r)
+	if err != nil {
+		return err
+	} else if fault != nil {
+		return fmt.Errorf("Got a fault instead of a call: %v", fault)
+	}
+
+	// only the rpc.Server read loop touches seq
+	c.seq++
+	r.Seq = c.seq
+
+	r.ServiceMethod = methodName
+	c.params, _ = params.([]interface{})
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(x interface{}) error {
+	params := c.params
+	c.params = nil
+	return assignParams(x, params)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	buf := bytes.NewBufferString("")
+	if r.Error != "" {
+		code, msg := errInternal, r.Error
+		if f, ok := ParseFault(r.Error); ok {
+			code, msg = f.Code, f.Msg
+		}
+		writeFault(buf, code, msg)
+		buf.WriteString("\n")
+	} else if err := marshalArray(buf, "", paramsOf(x)); err != nil {
+		buf.Reset()
+		writeFault(buf, errInternal,
+			fmt.Sprintf("Failed to marshal %s: %v", r.ServiceMethod, err))
+		buf.WriteString("\n")
+	}
+
+	// rpc.Server runs calls concurrently, but XML-RPC has no request id,
+	// so responses must go out in the order the calls came in
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[r.Seq] = buf.Bytes()
+	for {
+		b, ok := c.pending[c.next]
+		if !ok {
+			return nil
+		}
+		delete(c.pending, c.next)
+		c.next++
+		if _, err := c.rwc.Write(b); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *serverCodec) Close() error {
+	return c.rwc.Close()
+}
+
+type clientCodec struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+
+	result interface{}
+
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	pending []*rpc.Request // calls sent and not yet answered, oldest first
+}
+
+// NewClientCodec returns an rpc.ClientCodec which writes XML-RPC
+// <methodCall> documents to conn and reads the <methodResponse>
+// documents, which must come back in the order the calls were sent.
+//
+// Faults are reported by rpc.Client as an rpc.ServerError holding the
+// string of the Fault, "message (code#N)", which ParseFault reads back.
+func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{rwc: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, x interface{}) error {
+	buf := bytes.NewBufferString("")
+	if err := marshalArray(buf, r.ServiceMethod, paramsOf(x)); err != nil {
+		return err
+	}
+
+	// the response can be read before WriteTo returns on a synchronous
+	// connection, so the call must be pending first
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	c.pending = append(c.pending, &rpc.Request{ServiceMethod: r.ServiceMethod,
+		Seq: r.Seq})
+	c.mu.Unlock()
+	_, err := buf.WriteTo(c.rwc)
+	return err
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := skipSpace(c.r); err != nil {
+		return err
+	}
+	_, params, err, fault := Unmarshal(c.r)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return errors.New("Got a response without a pending call")
+	}
+	req := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	r.ServiceMethod = req.ServiceMethod
+	r.Seq = req.Seq
+	r.Error = ""
+	c.result = params
+	if fault != nil {
+		r.Error = fault.String()
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(x interface{}) error {
+	params, _ := c.result.([]interface{})
+	c.result = nil
+	return assignParams(x, params)
+}
+
+func (c *clientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+type httpResult struct {
+	resp   rpc.Response
+	params []interface{}
+}
+
+type httpClientCodec struct {
+	client  *Client
+	results chan *httpResult
+	closed  chan struct{}
+	once    sync.Once
+	params  []interface{}
+}
+
+// NewHTTPClientCodec returns an rpc.ClientCodec which sends every call
+// as a separate HTTP request through c, so calls made by rpc.Client run
+// in parallel. Faults are reported as with NewClientCodec.
+func NewHTTPClientCodec(c *Client) rpc.ClientCodec {
+	return &httpClientCodec{client: c, results: make(chan *httpResult),
+		closed: make(chan struct{})}
+}
+
+func (c *httpClientCodec) WriteRequest(r *rpc.Request, x interface{}) error {
+	res := &httpResult{resp: rpc.Response{ServiceMethod: r.ServiceMethod,
+		Seq: r.Seq}}
+	args := paramsOf(x)
+
+	go func() {
+		result, err, fault := c.client.RPCCall(res.resp.ServiceMethod, args...)
+		if err != nil {
+			res.resp.Error = err.Error()
+		} else if fault != nil {
+			res.resp.Error = fault.String()
+		} else {
+			res.params, _ = result.([]interface{})
+		}
+		select {
+		case c.results <- res:
+		case <-c.closed:
+		}
+	}()
+	return nil
+}
+
+func (c *httpClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	select {
+	case res := <-c.results:
+		*r = res.resp
+		c.params = res.params
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+func (c *httpClientCodec) ReadResponseBody(x interface{}) error {
+	params := c.params
+	c.params = nil
+	return assignParams(x, params)
+}
+
+func (c *httpClientCodec) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// one request body and the buffered response of an HTTP call
+type httpConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (httpConn) Close() error { return nil }
+
+type rpcHandler struct {
+	srv *rpc.Server
+}
+
+// NewRPCHandler returns an http.Handler which serves XML-RPC requests
+// with the methods registered on srv
+func NewRPCHandler(srv *rpc.Server) http.Handler {
+	return &rpcHandler{srv: srv}
+}
+
+func (h *rpcHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	buf := bytes.NewBufferString("")
+	codec := NewServerCodec(httpConn{req.Body, buf})
+	err := h.srv.ServeRequest(codec)
+	if err != nil && buf.Len() == 0 {
+		buf.Reset()
+		writeFault(buf, errNotWellFormed, fmt.Sprintf("Unmarshal error: %v", err))
+	}
+	resp.Header().Set("Content-Type", "text/xml")
+	buf.WriteTo(resp)
+}
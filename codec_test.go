@@ -0,0 +1,134 @@
+package xmlrpc
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+)
+
+type ArithArgs struct {
+	A, B int
+}
+
+type Arith int
+
+func (t *Arith) Mul(args ArithArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (t *Arith) Upper(args Params, reply *[]string) error {
+	for _, a := range args {
+		*reply = append(*reply, strings.ToUpper(a.(string)))
+	}
+	return nil
+}
+
+func (t *Arith) Div(args ArithArgs, reply *int) error {
+	if args.B == 0 {
+		return NewFault(42, "divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func newArithServer(t *testing.T) *rpc.Server {
+	srv := rpc.NewServer()
+	if err := srv.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func checkArith(t *testing.T, c *rpc.Client) {
+	var product int
+	if err := c.Call("Arith.Mul", &ArithArgs{6, 7}, &product); err != nil {
+		t.Fatal(err)
+	}
+	if product != 42 {
+		t.Errorf("Mul returned %d", product)
+	}
+
+	var up []string
+	if err := c.Call("Arith.Upper", Params{"a", "b"}, &up); err != nil {
+		t.Fatal(err)
+	}
+	if len(up) != 2 || up[0] != "A" || up[1] != "B" {
+		t.Errorf("Upper returned %v", up)
+	}
+
+	calls := make([]*rpc.Call, 10)
+	replies := make([]int, 10)
+	for i := range calls {
+		calls[i] = c.Go("Arith.Mul", ArithArgs{i, 2}, &replies[i], nil)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if call.Error != nil || replies[i] != i*2 {
+			t.Errorf("call #%d returned %d, %v", i, replies[i], call.Error)
+		}
+	}
+
+	err := c.Call("Arith.Mod", ArithArgs{1, 2}, &product)
+	if _, ok := err.(rpc.ServerError); !ok {
+		t.Errorf("expect a server error, got %v", err)
+	}
+
+	// the code of a fault goes through net/rpc
+	err = c.Call("Arith.Div", ArithArgs{1, 0}, &product)
+	se, _ := err.(rpc.ServerError)
+	if f, ok := ParseFault(string(se)); !ok || f.Code != 42 ||
+		f.Msg != "divide by zero" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	for _, s := range []string{"", "oops", "x (code#)", "x (code#1", "NilFault"} {
+		if _, ok := ParseFault(s); ok {
+			t.Errorf("%q parsed", s)
+		}
+	}
+	f := NewFault(-3, "a (code#1) b")
+	if g, ok := ParseFault(f.String()); !ok || *g != *f {
+		t.Errorf("got %v", g)
+	}
+}
+
+func TestCodecConn(t *testing.T) {
+	srv := newArithServer(t)
+	cli, svr := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(svr))
+
+	c := rpc.NewClientWithCodec(NewClientCodec(cli))
+	defer c.Close()
+	checkArith(t, c)
+}
+
+func TestCodecHTTP(t *testing.T) {
+	hs := httptest.NewServer(NewRPCHandler(newArithServer(t)))
+	defer hs.Close()
+
+	xc, err := NewClient(hs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := rpc.NewClientWithCodec(NewHTTPClientCodec(xc))
+	defer c.Close()
+	checkArith(t, c)
+
+	// a plain XML-RPC client can call the rpc.Server too
+	r, err, f := xc.RPCCall("Arith.Mul", map[string]interface{}{"A": 3, "B": 5})
+	if err != nil || f != nil {
+		t.Fatalf("RPCCall failed: %v %v", err, f)
+	}
+	if p := r.([]interface{}); len(p) != 1 || p[0] != 15 {
+		t.Errorf("RPCCall returned %v", r)
+	}
+	_, err, f = xc.RPCCall("Arith.Div", map[string]interface{}{"A": 3})
+	if err != nil || f == nil || f.Code != 42 || f.Msg != "divide by zero" {
+		t.Errorf("got %v, %v", err, f)
+	}
+}
@@ -0,0 +1,600 @@
+package xmlrpc
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Decoder reads XML-RPC documents from an input stream.
+//
+// By default it is lenient and accepts these deviations from the
+// XML-RPC spec, which are common in the wild:
+//
+//   - the <i8> and <nil/> extensions
+//   - white space around the text of numbers, booleans and dates
+//   - <int> values which do not fit in 32 bits
+//   - doubles with an exponent, and NaN or Inf
+//   - base64 without padding
+//   - repeated struct member names, the last one wins in Member and
+//     Interface
+//   - a methodCall without a methodName, or with it after the params
+//   - a methodResponse with more than one param, or none
+//   - anything after the end of the root element
+//
+// With Strict set all of them are errors, and so is a fault which is
+// not a struct of an int faultCode and a string faultString.
+type Decoder struct {
+	r      io.Reader
+	Strict bool
+	// CharsetReader converts documents which declare a charset other
+	// than UTF-8, as in xml.Decoder. When nil the package CharsetReader
+	// is used.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+}
+
+// SyntaxError reports a document which is not well formed XML or not a
+// valid XML-RPC message, and where the problem was found
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// UnmarshalValue decodes a methodCall or methodResponse read from r into
+// a Message of Values
+func UnmarshalValue(r io.Reader) (*Message, error) {
+	return NewDecoder(r).DecodeMessage()
+}
+
+// DecodeMessage reads one methodCall or methodResponse and returns it as
+// a lossless tree of Values
+func (d *Decoder) DecodeMessage() (*Message, error) {
+	if d.r == nil {
+		return nil, errors.New("reader is nil")
+	}
+	vp := &valueParser{p: xml.NewDecoder(d.r), strict: d.Strict}
+	vp.p.CharsetReader = d.CharsetReader
+	if vp.p.CharsetReader == nil {
+		vp.p.CharsetReader = CharsetReader
+	}
+	m, err := vp.message()
+	if err != nil {
+		return nil, vp.syntaxError(err)
+	}
+	return m, nil
+}
+
+// Decode reads one methodCall or methodResponse and returns it like
+// Unmarshal does
+func (d *Decoder) Decode() (string, interface{}, error, *Fault) {
+	m, err := d.DecodeMessage()
+	if err != nil {
+		return "", nil, err, nil
+	}
+	if m.Fault != nil {
+		f, err := faultFromValue(m.Fault)
+		if err != nil {
+			return "", nil, err, nil
+		}
+		return m.MethodName, nil, nil, f
+	}
+
+	params := make([]interface{}, len(m.Params))
+	for i, p := range m.Params {
+		if params[i], err = p.Interface(); err != nil {
+			return "", nil, err, nil
+		}
+	}
+	return m.MethodName, params, nil, nil
+}
+
+// UnmarshalStrict is Unmarshal with a strict Decoder, documents which do
+// not follow the XML-RPC spec give a *SyntaxError
+func UnmarshalStrict(r io.Reader) (string, interface{}, error, *Fault) {
+	d := NewDecoder(r)
+	d.Strict = true
+	return d.Decode()
+}
+
+// SetStrict makes the client check responses against the XML-RPC spec,
+// a response which does not follow it gives a *SyntaxError
+func (c *Client) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// convert the fault value of a methodResponse
+func faultFromValue(v *Value) (*Fault, error) {
+	val, err := v.Interface()
+	if err != nil {
+		return nil, err
+	}
+	return faultFromData(val), nil
+}
+
+// a recursive descent parser building Values
+type valueParser struct {
+	p      *xml.Decoder
+	strict bool
+	depth  int // of the <value> being read
+}
+
+func (vp *valueParser) errorf(format string, args ...interface{}) error {
+	line, col := vp.p.InputPos()
+	return &SyntaxError{Line: line, Column: col,
+		Msg: fmt.Sprintf(format, args...)}
+}
+
+// give errors of the XML decoder a position too
+func (vp *valueParser) syntaxError(err error) error {
+	switch e := err.(type) {
+	case *SyntaxError:
+		return e
+	case *xml.SyntaxError:
+		_, col := vp.p.InputPos()
+		return &SyntaxError{Line: e.Line, Column: col, Msg: e.Msg}
+	}
+	return err
+}
+
+// get the next start element, end element or non space text, skipping
+// comments, processing instructions and white space
+func (vp *valueParser) next() (xml.Token, error) {
+	for {
+		tok, err := vp.p.Token()
+		if err == io.EOF {
+			return nil, vp.errorf("Unexpected end-of-file")
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement, xml.EndElement:
+			return t, nil
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				return t.Copy(), nil
+			}
+		}
+	}
+}
+
+// get the next start element, or the end element of name
+func (vp *valueParser) nextStart(name string) (*xml.StartElement, error) {
+	tok, err := vp.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case xml.StartElement:
+		return &t, nil
+	case xml.EndElement:
+		if t.Name.Local == name {
+			return nil, nil
+		}
+		return nil, vp.errorf("Unexpected </%s> in <%s>", t.Name.Local, name)
+	case xml.CharData:
+		return nil, vp.errorf("Unexpected text %q in <%s>", string(t), name)
+	}
+	return nil, vp.errorf("Unexpected token in <%s>", name)
+}
+
+// expect the end element of name
+func (vp *valueParser) end(name string) error {
+	se, err := vp.nextStart(name)
+	if err != nil {
+		return err
+	} else if se != nil {
+		return vp.errorf("Unexpected <%s> in <%s>", se.Name.Local, name)
+	}
+	return nil
+}
+
+// read the text of an element up to its end element
+func (vp *valueParser) text(name string) (string, error) {
+	var sb strings.Builder
+	for {
+		tok, err := vp.p.Token()
+		if err == io.EOF {
+			return "", vp.errorf("Unexpected end-of-file in <%s>", name)
+		} else if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.EndElement:
+			return sb.String(), nil
+		case xml.StartElement:
+			return "", vp.errorf("Unexpected <%s> in <%s>", t.Name.Local, name)
+		}
+	}
+}
+
+func (vp *valueParser) message() (*Message, error) {
+	var root *xml.StartElement
+	for root == nil {
+		tok, err := vp.p.Token()
+		if err == io.EOF {
+			return nil, vp.errorf("No methodCall or methodResponse")
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			root = &t
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				return nil, vp.errorf("Unexpected text %q", string(t))
+			}
+		}
+	}
+
+	m := &Message{}
+	switch root.Name.Local {
+	case "methodCall":
+	case "methodResponse":
+		m.Response = true
+	default:
+		return nil, vp.errorf("Unrecognized tag <%s>", root.Name.Local)
+	}
+
+	seen := make(map[string]bool)
+	for {
+		se, err := vp.nextStart(root.Name.Local)
+		if err != nil {
+			return nil, err
+		} else if se == nil {
+			break
+		}
+
+		name := se.Name.Local
+		if vp.strict {
+			if seen[name] || (seen["params"] && name == "fault") ||
+				(seen["fault"] && name == "params") {
+				return nil, vp.errorf("Unexpected <%s> in <%s>", name,
+					root.Name.Local)
+			}
+			if !m.Response && name != "methodName" && !seen["methodName"] {
+				return nil, vp.errorf("<methodName> must come first")
+			}
+		}
+		seen[name] = true
+
+		switch {
+		case name == "methodName" && !m.Response:
+			if m.MethodName, err = vp.text("methodName"); err != nil {
+				return nil, err
+			}
+			if vp.strict && !validMethodName(m.MethodName) {
+				return nil, vp.errorf("Bad method name %q", m.MethodName)
+			}
+		case name == "params":
+			if m.Params, err = vp.params(); err != nil {
+				return nil, err
+			}
+			if vp.strict && m.Response && len(m.Params) != 1 {
+				return nil, vp.errorf("A methodResponse needs one param,"+
+					" got %d", len(m.Params))
+			}
+		case name == "fault" && m.Response:
+			if m.Fault, err = vp.valueIn("fault"); err != nil {
+				return nil, err
+			}
+			if vp.strict {
+				if err = vp.checkFault(m.Fault); err != nil {
+					return nil, err
+				}
+			}
+			if err = vp.end("fault"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, vp.errorf("Unexpected <%s> in <%s>", name,
+				root.Name.Local)
+		}
+	}
+
+	if vp.strict {
+		if !m.Response && !seen["methodName"] {
+			return nil, vp.errorf("Missing <methodName>")
+		} else if m.Response && !seen["params"] && !seen["fault"] {
+			return nil, vp.errorf("Missing <params> or <fault>")
+		}
+		if err := vp.trailer(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// check only white space, comments and processing instructions follow
+// the root element
+func (vp *valueParser) trailer() error {
+	for {
+		tok, err := vp.p.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return vp.errorf("Unexpected <%s> after the root element",
+				t.Name.Local)
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				return vp.errorf("Unexpected text %q after the root element",
+					string(t))
+			}
+		}
+	}
+}
+
+// the spec allows letters, digits, '_', '.', ':' and '/' in method names
+func validMethodName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '.', c == ':', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// a fault is a struct of exactly an int faultCode and a string faultString
+func (vp *valueParser) checkFault(v *Value) error {
+	code, msg := v.Member("faultCode"), v.Member("faultString")
+	if len(v.Members) != 2 || code == nil || code.Kind != Int ||
+		msg == nil || msg.Kind != String {
+		return vp.errorf("A fault needs an int faultCode and a string" +
+			" faultString")
+	}
+	return nil
+}
+
+func (vp *valueParser) params() ([]*Value, error) {
+	params := make([]*Value, 0)
+	for {
+		se, err := vp.nextStart("params")
+		if err != nil {
+			return nil, err
+		} else if se == nil {
+			return params, nil
+		}
+		if se.Name.Local != "param" {
+			return nil, vp.errorf("Unexpected <%s> in <params>", se.Name.Local)
+		}
+
+		v, err := vp.valueIn("param")
+		if err != nil {
+			return nil, err
+		}
+		if err = vp.end("param"); err != nil {
+			return nil, err
+		}
+		params = append(params, v)
+	}
+}
+
+// read the <value> inside the element name
+func (vp *valueParser) valueIn(name string) (*Value, error) {
+	se, err := vp.nextStart(name)
+	if err != nil {
+		return nil, err
+	} else if se == nil {
+		return nil, vp.errorf("Missing <value> in <%s>", name)
+	} else if se.Name.Local != "value" {
+		return nil, vp.errorf("Unexpected <%s> in <%s>", se.Name.Local, name)
+	}
+	return vp.value()
+}
+
+// read the content of a <value>, up to and including </value>
+func (vp *valueParser) value() (*Value, error) {
+	if vp.depth >= maxDepth {
+		return nil, vp.errorf("Values nested deeper than %d", maxDepth)
+	}
+	vp.depth++
+	defer func() { vp.depth-- }()
+
+	var raw strings.Builder
+	for {
+		tok, err := vp.p.Token()
+		if err == io.EOF {
+			return nil, vp.errorf("Unexpected end-of-file in <value>")
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			raw.Write(t)
+		case xml.EndElement:
+			// no type element, the text is a string
+			return &Value{Kind: String, Text: raw.String()}, nil
+		case xml.StartElement:
+			if strings.TrimSpace(raw.String()) != "" {
+				return nil, vp.errorf("Unexpected text %q in <value>",
+					raw.String())
+			}
+			v, err := vp.typed(&t)
+			if err != nil {
+				return nil, err
+			}
+			return v, vp.end("value")
+		}
+	}
+}
+
+// read the type element inside a <value>
+func (vp *valueParser) typed(se *xml.StartElement) (*Value, error) {
+	tag := se.Name.Local
+	v := &Value{Tag: tag}
+	switch tag {
+	case "int", "i4", "i8":
+		v.Kind = Int
+	case "boolean":
+		v.Kind = Boolean
+	case "string":
+		v.Kind = String
+	case "double":
+		v.Kind = Double
+	case "dateTime.iso8601":
+		v.Kind = DateTime
+	case "base64":
+		v.Kind = Base64
+	case "nil":
+		if vp.strict {
+			return nil, vp.errorf("<nil/> is an extension")
+		}
+		v.Kind = Nil
+		return v, vp.end(tag)
+	case "struct":
+		v.Kind = Struct
+		return v, vp.members(v)
+	case "array":
+		v.Kind = Array
+		return v, vp.items(v)
+	default:
+		return nil, vp.errorf("Unknown type <%s>", tag)
+	}
+
+	var err error
+	if v.Text, err = vp.text(tag); err != nil {
+		return nil, err
+	}
+	if vp.strict {
+		if err = vp.checkText(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+var (
+	intRE    = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	doubleRE = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+)
+
+// check the text of a scalar has the form the spec gives for its type
+func (vp *valueParser) checkText(v *Value) error {
+	ok := true
+	switch v.Kind {
+	case Int:
+		if v.Tag == "i8" {
+			return vp.errorf("<i8> is an extension")
+		}
+		ok = intRE.MatchString(v.Text)
+		if ok {
+			_, err := strconv.ParseInt(v.Text, 10, 32)
+			ok = err == nil
+		}
+	case Boolean:
+		ok = v.Text == "0" || v.Text == "1"
+	case Double:
+		ok = doubleRE.MatchString(v.Text)
+	case DateTime:
+		_, err := time.Parse(ISO8601_LAYOUT, v.Text)
+		ok = err == nil
+	case Base64:
+		_, err := base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, v.Text))
+		ok = err == nil
+	}
+	if !ok {
+		return vp.errorf("Bad <%s> value %q", v.Tag, v.Text)
+	}
+	return nil
+}
+
+func (vp *valueParser) members(v *Value) error {
+	var seen map[string]struct{} // member names, only in strict mode
+	if vp.strict {
+		seen = make(map[string]struct{})
+	}
+	for {
+		se, err := vp.nextStart("struct")
+		if err != nil {
+			return err
+		} else if se == nil {
+			return nil
+		} else if se.Name.Local != "member" {
+			return vp.errorf("Unexpected <%s> in <struct>", se.Name.Local)
+		}
+
+		se, err = vp.nextStart("member")
+		if err != nil {
+			return err
+		} else if se == nil || se.Name.Local != "name" {
+			return vp.errorf("Missing <name> in <member>")
+		}
+		name, err := vp.text("name")
+		if err != nil {
+			return err
+		}
+		m, err := vp.valueIn("member")
+		if err != nil {
+			return err
+		}
+		if err = vp.end("member"); err != nil {
+			return err
+		}
+		if vp.strict {
+			if _, ok := seen[name]; ok {
+				return vp.errorf("Repeated member name %q", name)
+			}
+			seen[name] = struct{}{}
+		}
+		v.Members = append(v.Members, Member{Name: name, Value: m})
+	}
+}
+
+func (vp *valueParser) items(v *Value) error {
+	se, err := vp.nextStart("array")
+	if err != nil {
+		return err
+	} else if se == nil || se.Name.Local != "data" {
+		return vp.errorf("Missing <data> in <array>")
+	}
+
+	v.Items = make([]*Value, 0)
+	for {
+		se, err := vp.nextStart("data")
+		if err != nil {
+			return err
+		} else if se == nil {
+			break
+		} else if se.Name.Local != "value" {
+			return vp.errorf("Unexpected <%s> in <data>", se.Name.Local)
+		}
+		item, err := vp.value()
+		if err != nil {
+			return err
+		}
+		v.Items = append(v.Items, item)
+	}
+	return vp.end("array")
+}
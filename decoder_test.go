@@ -0,0 +1,169 @@
+package xmlrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeDoc(doc string, strict bool) (string, interface{}, error, *Fault) {
+	d := NewDecoder(strings.NewReader(doc))
+	d.Strict = strict
+	return d.Decode()
+}
+
+func TestDecoderStrictValid(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<methodCall>
+  <methodName>sample.sum_and/diff:2</methodName>
+  <params>
+    <param><value><i4>-41</i4></value></param>
+    <param><value>raw</value></param>
+    <param><value><double>+1.5</double></value></param>
+    <param><value><struct>
+      <member><name>b</name><value><boolean>1</boolean></value></member>
+      <member><name>when</name><value><dateTime.iso8601>19980717T14:08:55</dateTime.iso8601></value></member>
+    </struct></value></param>
+    <param><value><array><data>
+      <value><base64>eW91
+IGNhbid0IHJlYWQgdGhpcyE=</base64></value>
+    </data></array></value></param>
+  </params>
+</methodCall>
+`
+	name, params, err, fault := decodeDoc(doc, true)
+	if err != nil || fault != nil {
+		t.Fatal(err, fault)
+	}
+	if name != "sample.sum_and/diff:2" {
+		t.Errorf("method name %q", name)
+	}
+	p := params.([]interface{})
+	if len(p) != 5 || p[0] != -41 || p[1] != "raw" || p[2] != 1.5 {
+		t.Errorf("params %#v", p)
+	}
+	if b := p[4].([]interface{})[0]; string(b.([]byte)) != "you can't read this!" {
+		t.Errorf("base64 %q", b)
+	}
+
+	// the lenient decoder gives the same as Unmarshal
+	_, lp, err, _ := decodeDoc(doc, false)
+	_, up, uerr, _ := UnmarshalString(doc)
+	if err != nil || uerr != nil || !reflect.DeepEqual(lp, up) {
+		t.Errorf("lenient %#v, %v\nUnmarshal %#v, %v", lp, err, up, uerr)
+	}
+}
+
+func TestDecoderStrictErrors(t *testing.T) {
+	call := func(params string) string {
+		return "<methodCall><methodName>m</methodName><params>" + params +
+			"</params></methodCall>"
+	}
+	value := func(v string) string {
+		return call("<param><value>" + v + "</value></param>")
+	}
+	resp := func(body string) string {
+		return "<methodResponse>" + body + "</methodResponse>"
+	}
+	fault := func(members string) string {
+		return resp("<fault><value><struct>" + members +
+			"</struct></value></fault>")
+	}
+
+	tests := []struct {
+		doc string
+		msg string
+	}{
+		{value("<i8>1</i8>"), "<i8> is an extension"},
+		{value("<nil/>"), "<nil/> is an extension"},
+		{value("<int> 1</int>"), `Bad <int> value " 1"`},
+		{value("<int>2147483648</int>"), "Bad <int> value"},
+		{value("<boolean>true</boolean>"), "Bad <boolean> value"},
+		{value("<double>1e5</double>"), "Bad <double> value"},
+		{value("<double>NaN</double>"), "Bad <double> value"},
+		{value("<dateTime.iso8601>1998-07-17</dateTime.iso8601>"),
+			"Bad <dateTime.iso8601> value"},
+		{value("<base64>eW91</base64>"), ""},
+		{value("<base64>eW9</base64>"), "Bad <base64> value"},
+		{value("<struct><member><name>a</name><value>1</value></member>" +
+			"<member><name>a</name><value>2</value></member></struct>"),
+			`Repeated member name "a"`},
+		{"<methodCall><params/></methodCall>", "<methodName> must come first"},
+		{"<methodCall><methodName>a b</methodName></methodCall>",
+			`Bad method name "a b"`},
+		{"<methodCall><methodName>m</methodName></methodCall>junk",
+			"after the root element"},
+		{resp("<params/>"), "needs one param, got 0"},
+		{resp(""), "Missing <params> or <fault>"},
+		{fault("<member><name>faultCode</name><value><string>4</string></value></member>" +
+			"<member><name>faultString</name><value>x</value></member>"),
+			"A fault needs"},
+		{fault("<member><name>faultCode</name><value><int>4</int></value></member>"),
+			"A fault needs"},
+	}
+	for _, tt := range tests {
+		_, _, err, _ := decodeDoc(tt.doc, true)
+		if tt.msg == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.doc, err)
+			}
+			continue
+		}
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%s: got %#v, expected a *SyntaxError", tt.doc, err)
+			continue
+		}
+		if !strings.Contains(se.Msg, tt.msg) {
+			t.Errorf("%s: got %q, expected %q", tt.doc, se.Msg, tt.msg)
+		}
+
+		// all of them are parsed by the lenient decoder
+		if _, err = UnmarshalValue(strings.NewReader(tt.doc)); err != nil {
+			t.Errorf("lenient %s: %v", tt.doc, err)
+		}
+	}
+}
+
+func TestDecoderPosition(t *testing.T) {
+	doc := "<methodResponse>\n<params>\n<param>\n  <value><boolean>2</boolean></value>"
+	_, _, err, _ := decodeDoc(doc, true)
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("got %#v", err)
+	}
+	if se.Line != 4 || se.Column != 30 {
+		t.Errorf("got line %d, column %d", se.Line, se.Column)
+	}
+	if err.Error() != `line 4, column 30: Bad <boolean> value "2"` {
+		t.Errorf("got %q", err.Error())
+	}
+
+	_, _, err, _ = decodeDoc("<methodResponse>\n<params></param>", false)
+	if se, ok := err.(*SyntaxError); !ok || se.Line != 2 {
+		t.Errorf("got %#v", err)
+	}
+}
+
+func TestClientStrict(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		w.Write([]byte(`<methodResponse><params><param><value><nil/>` +
+			`</value></param></params></methodResponse>`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err, _ := c.RPCCall("m"); err != nil || res.([]interface{})[0] != nil {
+		t.Errorf("got %v, %v", res, err)
+	}
+	c.SetStrict(true)
+	if _, err, _ := c.RPCCall("m"); err == nil {
+		t.Error("strict client accepted <nil/>")
+	}
+}
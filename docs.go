@@ -0,0 +1,205 @@
+package xmlrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DocOptions describe the documentation page a Handler serves on GET
+type DocOptions struct {
+	Title       string
+	Description string
+}
+
+// MethodDoc documents a registered method, its params and results are
+// named by their XML-RPC types
+type MethodDoc struct {
+	Name     string     `json:"name"`
+	Params   []ParamDoc `json:"params"`
+	Results  []string   `json:"results"`
+	Variadic bool       `json:"variadic,omitempty"` // the last param repeats
+	Help     string     `json:"help,omitempty"`
+}
+
+// ParamDoc documents a param of a method
+type ParamDoc struct {
+	Type     string      `json:"type"`
+	GoType   string      `json:"goType"`
+	Optional bool        `json:"optional,omitempty"`
+	Default  interface{} `json:"default,omitempty"` // set when Optional
+}
+
+// SetDocs makes the handler answer GET with a page documenting its
+// methods, in HTML, or in JSON for "?format=json" or when JSON is
+// accepted. nil stops it.
+func (h *Handler) SetDocs(opts *DocOptions) {
+	h.docs = opts
+}
+
+// SetHelp sets the help text of a registered method
+func (h *Handler) SetHelp(name, help string) error {
+	md, ok := h.methods[name]
+	if !ok {
+		return fmt.Errorf("Unknown method \"%s\"", name)
+	}
+	md.help = help
+	return nil
+}
+
+// Docs documents the registered methods, sorted by name
+func (h *Handler) Docs() []MethodDoc {
+	docs := make([]MethodDoc, 0, len(h.methods))
+	for name, md := range h.methods {
+		if name != md.name {
+			// the lower case alias made by Register
+			continue
+		}
+		docs = append(docs, md.doc(name))
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+func (md *methodData) doc(name string) MethodDoc {
+	d := MethodDoc{Name: name, Params: []ParamDoc{}, Results: []string{},
+		Variadic: md.ftype.IsVariadic(), Help: md.help}
+	n := md.ftype.NumIn()
+	i := 0
+	if md.obj != nil {
+		i++
+	}
+	// filled in by the handler, as in getVals
+	if i < n && md.ftype.In(i) == contextType {
+		i++
+	}
+	if i < n && md.ftype.In(i) == reflect.TypeOf((*http.Request)(nil)) {
+		i++
+	}
+	dl := len(md.dft)
+	for ; i < n; i++ {
+		t := md.ftype.In(i)
+		if d.Variadic && i == n-1 {
+			t = t.Elem()
+		}
+		p := ParamDoc{Type: xmlrpcType(t), GoType: t.String()}
+		if dl > 0 && dl+i >= n {
+			p.Optional = true
+			p.Default = md.dft[dl-n+i]
+		}
+		d.Params = append(d.Params, p)
+	}
+	for i := 0; i < md.ftype.NumOut(); i++ {
+		d.Results = append(d.Results, xmlrpcType(md.ftype.Out(i)))
+	}
+	return d
+}
+
+// the XML-RPC type a Go type is sent as
+func xmlrpcType(t reflect.Type) string {
+	switch t {
+	case timeType:
+		return "dateTime.iso8601"
+	case valueType, valuePtrType:
+		return "value"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "base64"
+		}
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "struct"
+	case reflect.Ptr:
+		return xmlrpcType(t.Elem())
+	}
+	return "value"
+}
+
+// Signature formats d like "add(int, int = 1) int"
+func (d MethodDoc) Signature() string {
+	params := make([]string, len(d.Params))
+	for i, p := range d.Params {
+		params[i] = p.Type
+		if d.Variadic && i == len(d.Params)-1 {
+			params[i] += "..."
+		}
+		if p.Optional {
+			params[i] += " = " + formatDefault(p.Default)
+		}
+	}
+	s := d.Name + "(" + strings.Join(params, ", ") + ")"
+	switch len(d.Results) {
+	case 0:
+	case 1:
+		s += " " + d.Results[0]
+	default:
+		s += " (" + strings.Join(d.Results, ", ") + ")"
+	}
+	return s
+}
+
+func formatDefault(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+var docTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+code { font-size: 1.1em; }
+.help { white-space: pre-wrap; margin: 0.5em 0 1.5em 2em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Description}}<p class="help">{{.Description}}</p>
+{{end}}<ul>
+{{range .Methods}}<li><a href="#{{.Name}}">{{.Name}}</a></li>
+{{end}}</ul>
+{{range .Methods}}<h2 id="{{.Name}}"><code>{{.Signature}}</code></h2>
+{{if .Help}}<p class="help">{{.Help}}</p>
+{{end}}{{end}}</body>
+</html>
+`))
+
+func (h *Handler) serveDocs(resp http.ResponseWriter, req *http.Request) {
+	title := h.docs.Title
+	if title == "" {
+		title = "XML-RPC methods"
+	}
+	page := struct {
+		Title       string      `json:"title"`
+		Description string      `json:"description,omitempty"`
+		Methods     []MethodDoc `json:"methods"`
+	}{title, h.docs.Description, h.Docs()}
+
+	if req.URL.Query().Get("format") == "json" ||
+		strings.Contains(req.Header.Get("Accept"), "application/json") {
+		resp.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(resp).Encode(page)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	docTemplate.Execute(resp, page)
+}
@@ -0,0 +1,86 @@
+package xmlrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type docService struct{}
+
+func (docService) Report(ctx context.Context, from time.Time, tags []string) (map[string]int, error) {
+	return nil, nil
+}
+
+func TestDocs(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(a int, scale float64, unit string) float64 { return 0 },
+		"convert", DFT{2.5, "m"})
+	h.RegFunc(func(parts ...[]byte) bool { return true }, "join", nil)
+	h.Register(docService{}, nil, false)
+	if err := h.SetHelp("convert", "Converts a <length>."); err != nil {
+		t.Fatal(err)
+	}
+	if h.SetHelp("nothing", "") == nil {
+		t.Error("expected an error for an unknown method")
+	}
+
+	docs := h.Docs()
+	if len(docs) != 3 {
+		t.Fatalf("got %+v", docs)
+	}
+	for i, exp := range []string{
+		`Report(dateTime.iso8601, array) (struct, value)`,
+		`convert(int, double = 2.5, string = "m") double`,
+		`join(base64...) boolean`,
+	} {
+		if s := docs[i].Signature(); s != exp {
+			t.Errorf("got %s, expected %s", s, exp)
+		}
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+	if resp, err := s.Client().Get(s.URL); err != nil || resp.StatusCode != 200 ||
+		strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		t.Errorf("docs served without SetDocs: %v", err)
+	}
+
+	h.SetDocs(&DocOptions{Title: "Units"})
+	resp, err := s.Client().Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, part := range []string{"<title>Units</title>",
+		`convert(int, double = 2.5, string = &#34;m&#34;) double`,
+		"Converts a &lt;length&gt;."} {
+		if !strings.Contains(string(page), part) {
+			t.Errorf("missing %s in\n%s", part, page)
+		}
+	}
+
+	resp, err = s.Client().Get(s.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Title   string
+		Methods []MethodDoc
+	}
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := got.Methods[1].Params[2]
+	if got.Title != "Units" || len(got.Methods) != 3 || !p.Optional ||
+		p.Default != "m" || p.GoType != "string" {
+		t.Errorf("got %+v", got)
+	}
+}
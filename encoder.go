@@ -0,0 +1,218 @@
+package xmlrpc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format selects the layout of the XML written by an Encoder
+type Format int
+
+const (
+	// FormatDefault is the layout Marshal has always written
+	FormatDefault Format = iota
+	// FormatCanonical has no white space between elements, struct
+	// members sorted by name and no trailing newline, so equal data
+	// always gives equal bytes
+	FormatCanonical
+	// FormatPretty puts every element on its own line, indented by depth
+	FormatPretty
+)
+
+// NilPolicy says how an Encoder writes nil pointers, maps, slices and
+// interfaces
+type NilPolicy int
+
+const (
+	// NilValue writes them as <nil/>
+	NilValue NilPolicy = iota
+	// NilOmit leaves them out of structs, elsewhere they are <nil/>
+	NilOmit
+	// NilEmpty writes the empty value of their type, for peers which do
+	// not know <nil/>: an empty <struct> or <array>, a zero scalar for a
+	// pointer to one, and an empty <string> for an interface
+	NilEmpty
+)
+
+// InvalidPolicy says what an Encoder does with strings which cannot be
+// written in XML 1.0, because they are not valid UTF-8 or hold control
+// characters other than tab, newline and carriage return
+type InvalidPolicy int
+
+const (
+	// InvalidReplace writes U+FFFD in place of the bad characters
+	InvalidReplace InvalidPolicy = iota
+	// InvalidError fails to encode the document
+	InvalidError
+	// InvalidBase64 writes the bytes of the string as <base64> instead,
+	// names of members and methods cannot be and fail
+	InvalidBase64
+)
+
+// An Encoder writes XML-RPC documents with a chosen layout
+type Encoder struct {
+	Format Format
+	// SortMembers writes struct members in name order, it is implied by
+	// FormatCanonical. Members of a map are in random order otherwise.
+	SortMembers bool
+	// Indent is repeated once per level by FormatPretty, two spaces
+	// when empty
+	Indent string
+	Nil    NilPolicy
+	// Charset is declared in the XML prolog and the document is written
+	// in it, characters it does not have become character references.
+	// ISO-8859-1 and Windows-1252 are supported, empty means UTF-8.
+	Charset string
+	Invalid InvalidPolicy
+}
+
+// the encoder used by Marshal
+var defaultEncoder Encoder
+
+// Marshal writes a methodCall, or a methodResponse when methodName is
+// empty, holding args
+func (e *Encoder) Marshal(w io.Writer, methodName string, args ...interface{}) error {
+	return e.marshalArray(w, methodName, args)
+}
+
+// whether s is valid UTF-8 holding only characters allowed in XML 1.0
+func validXMLString(s string) bool {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return false
+			}
+		}
+		if !(r == 0x09 || r == 0x0A || r == 0x0D ||
+			r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD ||
+			r >= 0x10000 && r <= 0x10FFFF) {
+			return false
+		}
+	}
+	return true
+}
+
+// whether the string s can be written as text with the invalid policy
+func (es *encodeState) representable(s string) bool {
+	return es.Invalid == InvalidReplace || validXMLString(s)
+}
+
+// write the name of a member or method
+func (es *encodeState) escapeName(w io.Writer, name string) error {
+	if !es.representable(name) {
+		return fmt.Errorf("Name %q cannot be written in XML", name)
+	}
+	return xml.EscapeText(w, []byte(name))
+}
+
+// the Content-Type of the documents written by e
+func (e *Encoder) contentType() string {
+	if e == nil || isUTF8(e.Charset) || lookupCharset(e.Charset) == nil {
+		return "text/xml"
+	}
+	return "text/xml; charset=" + e.Charset
+}
+
+// state of a single document being written
+type encodeState struct {
+	*Encoder
+	indentStr string
+	seen      map[visit]bool // pointers, maps and slices being written
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func newEncodeState(e *Encoder) *encodeState {
+	if e == nil {
+		e = &defaultEncoder
+	}
+	es := &encodeState{Encoder: e, indentStr: e.Indent}
+	if es.indentStr == "" {
+		es.indentStr = "  "
+	}
+	return es
+}
+
+// note that val is being written, and fail when it already is, which
+// means it contains itself
+func (es *encodeState) enter(val reflect.Value) error {
+	v := visit{val.Pointer(), val.Type(), 0}
+	if val.Kind() == reflect.Slice {
+		v.len = val.Len()
+	}
+	if es.seen[v] {
+		return fmt.Errorf("Cyclic value of type %v", val.Type())
+	}
+	if es.seen == nil {
+		es.seen = make(map[visit]bool)
+	}
+	es.seen[v] = true
+	return nil
+}
+
+func (es *encodeState) leave(val reflect.Value) {
+	v := visit{val.Pointer(), val.Type(), 0}
+	if val.Kind() == reflect.Slice {
+		v.len = val.Len()
+	}
+	delete(es.seen, v)
+}
+
+// whether the struct member val is left out by the nil policy
+func (es *encodeState) omit(val reflect.Value) bool {
+	if es.Nil != NilOmit {
+		return false
+	}
+	for val.IsValid() {
+		switch val.Kind() {
+		case reflect.Interface:
+			if val.IsNil() {
+				return true
+			}
+			val = val.Elem()
+			continue
+		case reflect.Ptr, reflect.Map, reflect.Slice:
+			return val.IsNil()
+		}
+		return false
+	}
+	return true
+}
+
+func (es *encodeState) sortMembers() bool {
+	return es.SortMembers || es.Format == FormatCanonical
+}
+
+// start a new line at depth d, only in the pretty form
+func (es *encodeState) indent(w io.Writer, d int) {
+	if es.Format == FormatPretty {
+		fmt.Fprintf(w, "\n%s", strings.Repeat(es.indentStr, d))
+	}
+}
+
+// end a line, only in the default form
+func (es *encodeState) nl(w io.Writer) {
+	if es.Format == FormatDefault {
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// SetEncoder makes the handler write its responses with e, nil restores
+// the default layout
+func (h *Handler) SetEncoder(e *Encoder) {
+	h.enc = e
+}
+
+// SetEncoder makes the client write its requests with e, nil restores
+// the default layout
+func (c *Client) SetEncoder(e *Encoder) {
+	c.enc = e
+}
@@ -0,0 +1,371 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type encPoint struct {
+	Y int
+	X int
+}
+
+var encArgs = []interface{}{
+	map[string]interface{}{"b": 2, "a": []interface{}{"x", true}},
+	encPoint{Y: 1, X: 2},
+}
+
+func TestEncoderCanonical(t *testing.T) {
+	e := &Encoder{Format: FormatCanonical}
+	exp := `<?xml version="1.0"?><methodCall><methodName>m</methodName>` +
+		`<params><param><value><struct>` +
+		`<member><name>a</name><value><array><data>` +
+		`<value><string>x</string></value><value><boolean>1</boolean></value>` +
+		`</data></array></value></member>` +
+		`<member><name>b</name><value><int>2</int></value></member>` +
+		`</struct></value></param>` +
+		`<param><value><struct>` +
+		`<member><name>X</name><value><int>2</int></value></member>` +
+		`<member><name>Y</name><value><int>1</int></value></member>` +
+		`</struct></value></param></params></methodCall>`
+
+	// map order is random, every run must give the same bytes
+	for i := 0; i < 10; i++ {
+		buf := bytes.NewBufferString("")
+		if err := e.Marshal(buf, "m", encArgs...); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != exp {
+			t.Fatalf("got\n%s\nexpected\n%s", buf.String(), exp)
+		}
+	}
+}
+
+func TestEncoderPretty(t *testing.T) {
+	e := &Encoder{Format: FormatPretty, SortMembers: true}
+	buf := bytes.NewBufferString("")
+	if err := e.Marshal(buf, "", encArgs[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	exp := `<?xml version="1.0"?>
+<methodResponse>
+  <params>
+    <param>
+      <value><struct>
+        <member>
+          <name>a</name>
+          <value><array>
+            <data>
+              <value><string>x</string></value>
+              <value><boolean>1</boolean></value>
+            </data>
+          </array></value>
+        </member>
+        <member>
+          <name>b</name>
+          <value><int>2</int></value>
+        </member>
+      </struct></value>
+    </param>
+    <param>
+      <value><nil/></value>
+    </param>
+  </params>
+</methodResponse>
+`
+	if buf.String() != exp {
+		t.Fatalf("got\n%s\nexpected\n%s", buf.String(), exp)
+	}
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	m, err := UnmarshalValue(strings.NewReader(valueDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := m.Params[0].Interface()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []Format{FormatDefault, FormatCanonical, FormatPretty} {
+		e := &Encoder{Format: f, Indent: "\t"}
+		buf := bytes.NewBufferString("")
+		if err = e.Marshal(buf, "", m.Params[0]); err != nil {
+			t.Fatal(err)
+		}
+		_, params, err, _ := Unmarshal(buf)
+		if err != nil {
+			t.Fatalf("format %d: %v", f, err)
+		}
+		if got := params.([]interface{})[0]; !reflect.DeepEqual(got, want) {
+			t.Errorf("format %d: got %#v, expected %#v", f, got, want)
+		}
+	}
+}
+
+func TestEncoderDefault(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	p := encPoint{Y: 1, X: 2}
+	if err := Marshal(a, "m", p, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Encoder{}).Marshal(b, "m", p, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), a.String())
+	}
+}
+
+func TestHandlerSetEncoder(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() map[string]int { return map[string]int{"b": 2, "a": 1} },
+		"pair", nil)
+	h.SetEncoder(&Encoder{Format: FormatCanonical})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetEncoder(&Encoder{Format: FormatPretty})
+	resp, err := c.Post(s.URL, "text/xml", strings.NewReader(
+		`<methodCall><methodName>pair</methodName><params/></methodCall>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf := bytes.NewBufferString("")
+	buf.ReadFrom(resp.Body)
+	exp := `<?xml version="1.0"?><methodResponse><params><param><value>` +
+		`<struct><member><name>a</name><value><int>1</int></value></member>` +
+		`<member><name>b</name><value><int>2</int></value></member></struct>` +
+		`</value></param></params></methodResponse>`
+	if buf.String() != exp {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), exp)
+	}
+
+	res, err, fault := c.RPCCall("pair")
+	if err != nil || fault != nil {
+		t.Fatal(err, fault)
+	}
+	exp2 := map[string]interface{}{"a": 1, "b": 2}
+	if got := res.([]interface{})[0]; !reflect.DeepEqual(got, exp2) {
+		t.Errorf("got %#v", got)
+	}
+}
+
+type encItem struct {
+	Name  string
+	Price *float64
+	Tags  []string
+	Next  *encItem
+}
+
+func encodeCanonical(t *testing.T, e *Encoder, v interface{}) string {
+	e.Format = FormatCanonical
+	buf := bytes.NewBufferString("")
+	if err := e.Marshal(buf, "", v); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	return s[strings.Index(s, "<param><value>")+14 : strings.LastIndex(s, "</value></param>")]
+}
+
+func TestEncoderPointers(t *testing.T) {
+	price := 1.5
+	item := &encItem{Name: "a", Price: &price, Next: &encItem{Name: "b"}}
+
+	tests := []struct {
+		nil NilPolicy
+		exp string
+	}{
+		{NilValue, `<struct>` +
+			`<member><name>Name</name><value><string>a</string></value></member>` +
+			`<member><name>Next</name><value><struct>` +
+			`<member><name>Name</name><value><string>b</string></value></member>` +
+			`<member><name>Next</name><value><nil/></value></member>` +
+			`<member><name>Price</name><value><nil/></value></member>` +
+			`<member><name>Tags</name><value><nil/></value></member>` +
+			`</struct></value></member>` +
+			`<member><name>Price</name><value><double>1.5</double></value></member>` +
+			`<member><name>Tags</name><value><nil/></value></member>` +
+			`</struct>`},
+		{NilOmit, `<struct>` +
+			`<member><name>Name</name><value><string>a</string></value></member>` +
+			`<member><name>Next</name><value><struct>` +
+			`<member><name>Name</name><value><string>b</string></value></member>` +
+			`</struct></value></member>` +
+			`<member><name>Price</name><value><double>1.5</double></value></member>` +
+			`</struct>`},
+		{NilEmpty, `<struct>` +
+			`<member><name>Name</name><value><string>a</string></value></member>` +
+			`<member><name>Next</name><value><struct>` +
+			`<member><name>Name</name><value><string>b</string></value></member>` +
+			`<member><name>Next</name><value><struct></struct></value></member>` +
+			`<member><name>Price</name><value><double>0</double></value></member>` +
+			`<member><name>Tags</name><value><array><data></data></array></value></member>` +
+			`</struct></value></member>` +
+			`<member><name>Price</name><value><double>1.5</double></value></member>` +
+			`<member><name>Tags</name><value><array><data></data></array></value></member>` +
+			`</struct>`},
+	}
+	for _, tt := range tests {
+		if got := encodeCanonical(t, &Encoder{Nil: tt.nil}, item); got != tt.exp {
+			t.Errorf("policy %d: got\n%s\nexpected\n%s", tt.nil, got, tt.exp)
+		}
+	}
+
+	// the decoded struct fills the pointers again
+	buf := bytes.NewBufferString("")
+	if err := Marshal(buf, "", item); err != nil {
+		t.Fatal(err)
+	}
+	_, params, err, _ := Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back encItem
+	if err = Assign(&back, params.([]interface{})[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, item) {
+		t.Errorf("got back %#v", back)
+	}
+
+	m := map[string]interface{}{"a": nil, "b": []int(nil), "c": 1}
+	if got := encodeCanonical(t, &Encoder{Nil: NilOmit}, m); got !=
+		`<struct><member><name>c</name><value><int>1</int></value></member></struct>` {
+		t.Errorf("got %s", got)
+	}
+	if got := encodeCanonical(t, &Encoder{}, []interface{}{nil}); got !=
+		`<array><data><value><nil/></value></data></array>` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestEncoderCycle(t *testing.T) {
+	item := &encItem{Name: "loop"}
+	item.Next = item
+	if err := Marshal(bytes.NewBufferString(""), "", item); err == nil ||
+		!strings.Contains(err.Error(), "Cyclic") {
+		t.Errorf("got %v", err)
+	}
+
+	arr := []interface{}{1, nil}
+	arr[1] = arr
+	if err := Marshal(bytes.NewBufferString(""), "", arr); err == nil {
+		t.Error("cyclic slice should fail")
+	}
+
+	// the same pointer twice is not a cycle
+	shared := &encItem{Name: "x"}
+	if err := Marshal(bytes.NewBufferString(""), "", []*encItem{shared, shared}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncoderInvalidChars(t *testing.T) {
+	bad := "a\x00b\xffc"
+	tests := []struct {
+		policy InvalidPolicy
+		exp    string
+	}{
+		{InvalidReplace, "<string>a�b�c</string>"},
+		{InvalidBase64, "<base64>YQBi/2M=</base64>"},
+		{InvalidError, ""},
+	}
+	for _, tt := range tests {
+		e := &Encoder{Format: FormatCanonical, Invalid: tt.policy}
+		buf := bytes.NewBufferString("")
+		err := e.Marshal(buf, "", bad, "fine\ttab")
+		if tt.exp == "" {
+			if err == nil {
+				t.Errorf("policy %d: no error", tt.policy)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "<value>"+tt.exp+"</value>") ||
+			!strings.Contains(buf.String(), "<string>fine&#x9;tab</string>") {
+			t.Errorf("policy %d: got %s", tt.policy, buf.String())
+		}
+	}
+
+	if err := (&Encoder{Invalid: InvalidBase64}).Marshal(bytes.NewBufferString(""),
+		"", map[string]int{"\x01": 1}); err == nil {
+		t.Error("a bad member name should fail")
+	}
+	if err := (&Encoder{Invalid: InvalidError}).Marshal(bytes.NewBufferString(""),
+		"bad\x02name"); err == nil {
+		t.Error("a bad method name should fail")
+	}
+}
+
+// a *Value is written with the same policy
+func TestEncoderInvalidValue(t *testing.T) {
+	bad := NewString("a\x00b\xffc")
+	tests := []struct {
+		policy InvalidPolicy
+		exp    string
+	}{
+		{InvalidReplace, "<string>a\uFFFDb\uFFFDc</string>"},
+		{InvalidBase64, "<base64>YQBi/2M=</base64>"},
+		{InvalidError, ""},
+	}
+	for _, tt := range tests {
+		e := &Encoder{Format: FormatCanonical, Invalid: tt.policy}
+		buf := bytes.NewBufferString("")
+		err := e.Marshal(buf, "", NewArray(bad))
+		if tt.exp == "" {
+			if err == nil {
+				t.Errorf("policy %d: no error", tt.policy)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "<value>"+tt.exp+"</value>") {
+			t.Errorf("policy %d: got %s", tt.policy, buf.String())
+		}
+	}
+
+	v := NewStruct().Set("\x01", NewString("x"))
+	if err := (&Encoder{Invalid: InvalidBase64}).Marshal(bytes.NewBufferString(""),
+		"", v); err == nil {
+		t.Error("a bad member name should fail")
+	}
+}
+
+func TestHandlerInvalidFault(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() *Fault { return &Fault{Code: 9, Msg: "bad\x00byte"} },
+		"fail", nil)
+
+	for _, tt := range []struct {
+		policy InvalidPolicy
+		msg    string
+	}{
+		{InvalidReplace, "bad�byte"},
+		{InvalidBase64, "bad\x00byte"},
+	} {
+		h.SetEncoder(&Encoder{Invalid: tt.policy})
+		s := httptest.NewServer(h)
+		c, err := NewClient(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err, fault := c.RPCCall("fail")
+		s.Close()
+		if err != nil || fault == nil || fault.Code != 9 || fault.Msg != tt.msg {
+			t.Errorf("policy %d: got %v, %#v", tt.policy, err, fault)
+		}
+	}
+}
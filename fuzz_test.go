@@ -0,0 +1,136 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the seed corpus: documents as sent by real servers and clients, found
+// in testdata/seed
+func addSeeds(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "seed", "*.xml"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte(`<methodResponse><fault><value><int>7</int></value></fault></methodResponse>`))
+	f.Add([]byte(`<methodResponse><fault><value><struct></struct></value></fault></methodResponse>`))
+	f.Add([]byte(strings.Repeat("<value><array><data>", 50)))
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, doc []byte) {
+		Unmarshal(bytes.NewReader(doc))
+		UnmarshalStrict(bytes.NewReader(doc))
+
+		m, err := UnmarshalValue(bytes.NewReader(doc))
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := MarshalMessage(&buf, m); err != nil {
+			return
+		}
+		if _, err := UnmarshalValue(&buf); err != nil {
+			t.Errorf("cannot decode the document written for\n%s\n%v\n%s",
+				doc, err, buf.Bytes())
+		}
+	})
+}
+
+func FuzzMarshalRoundTrip(f *testing.F) {
+	f.Add(17, "Hello & bye", 3.14, []byte("you can't read this!"), true)
+	f.Add(-1, "<struct>", -1.5e-3, []byte{}, false)
+	f.Add(math.MaxInt32, "café\t\n", 1e300, []byte{0, 0xff}, true)
+	f.Fuzz(func(t *testing.T, i int, s string, d float64, b []byte, ok bool) {
+		if math.IsNaN(d) || math.IsInf(d, 0) || !validXMLString(s) {
+			t.Skip()
+		}
+		var buf bytes.Buffer
+		if err := Marshal(&buf, "m", i, s, d, b, ok); err != nil {
+			t.Fatal(err)
+		}
+		doc := buf.String()
+		method, params, err, fault := Unmarshal(&buf)
+		if err != nil || fault != nil {
+			t.Fatalf("%s\n%v, %v", doc, err, fault)
+		}
+		if len(b) == 0 {
+			b = []byte{}
+		}
+		exp := []interface{}{i, s, d, b, ok}
+		if method != "m" || !reflect.DeepEqual(params, exp) {
+			t.Errorf("%s\ngot %s %#v", doc, method, params)
+		}
+	})
+}
+
+func FuzzServeHTTP(f *testing.F) {
+	addSeeds(f)
+	f.Add([]byte(`<methodCall><methodName>echo</methodName><params><param><value><i4>1</i4></value></param></params></methodCall>`))
+	f.Add([]byte(`<methodCall><methodName>add</methodName><params><param><value><int>1</int></value></param><param><value><double>2</double></value></param></params></methodCall>`))
+
+	h := NewHandler()
+	h.RegFunc(func(v interface{}) interface{} { return v }, "echo", nil)
+	h.RegFunc(func(a, b int) int { return a + b }, "add", nil)
+	h.RegFunc(func(m map[string]interface{}) int { return len(m) }, "count", nil)
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest("POST", "/RPC2", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "text/xml")
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			return
+		}
+		if _, _, err, _ := Unmarshal(resp.Body); err != nil {
+			t.Errorf("cannot decode the response to\n%s\n%v", body, err)
+		}
+	})
+}
+
+func TestDeepNesting(t *testing.T) {
+	deep := func(open, close string) string {
+		n := maxDepth + 10
+		return `<methodResponse><params><param><value>` +
+			strings.Repeat(open, n) + strings.Repeat(close, n) +
+			`</value></param></params></methodResponse>`
+	}
+	for _, doc := range []string{
+		deep(`<array><data><value>`, `</value></data></array>`),
+		deep(`<struct><member><name>x</name><value>`, `</value></member></struct>`),
+	} {
+		if _, _, err, _ := UnmarshalString(doc); err == nil ||
+			!strings.Contains(err.Error(), "nested deeper") {
+			t.Errorf("Unmarshal: %v", err)
+		}
+		if _, err := UnmarshalValue(strings.NewReader(doc)); err == nil ||
+			!strings.Contains(err.Error(), "nested deeper") {
+			t.Errorf("UnmarshalValue: %v", err)
+		}
+	}
+
+	ok := `<methodResponse><params><param><value>` +
+		strings.Repeat(`<array><data><value>`, 100) + `<i4>1</i4>` +
+		strings.Repeat(`</value></data></array>`, 100) +
+		`</value></param></params></methodResponse>`
+	if _, _, err, _ := UnmarshalString(ok); err != nil {
+		t.Error(err)
+	}
+	if _, err := UnmarshalValue(strings.NewReader(ok)); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,3 +1,3 @@
 module xmlrpc
 
-go 1.16
+go 1.21
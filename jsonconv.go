@@ -0,0 +1,415 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversion between decoded XML-RPC data and JSON.
+//
+// Values map to plain JSON where that is not ambiguous: nil is null,
+// booleans, strings and arrays are themselves, an <int> is a number
+// without fraction or exponent and a <double> is a number that always
+// has one ("1.0"). The other types use a one member object whose name
+// starts with '$':
+//
+//	{"$dateTime.iso8601": "19980717T14:08:55"}
+//	{"$base64": "eW91IGNhbid0IHJlYWQgdGhpcyE="}
+//	{"$double": "NaN"}             NaN and infinities, which XML-RPC
+//	                               does not allow, so they are only read
+//	{"$struct": {"$ref": 1}}       a struct with a member starting with '$'
+//
+// A methodCall is {"methodName": ..., "params": [...]}, a methodResponse
+// is {"params": [...]} or {"fault": {"faultCode": ..., "faultString": ...}},
+// where the fault has the other members of the fault struct as well.
+
+const (
+	jsonDouble   = "$double"
+	jsonDateTime = "$dateTime.iso8601"
+	jsonBase64   = "$base64"
+	jsonStruct   = "$struct"
+)
+
+// ToJSONValue converts a value decoded by Unmarshal into the typed JSON
+// notation, the result can be given to json.Marshal
+func ToJSONValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, bool, string:
+		return t, nil
+	case int:
+		return json.Number(strconv.Itoa(t)), nil
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return map[string]interface{}{jsonDouble: strconv.FormatFloat(t,
+				'g', -1, 64)}, nil
+		}
+		s := strconv.FormatFloat(t, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return json.Number(s), nil
+	case time.Time:
+		return map[string]interface{}{jsonDateTime: t.Format(ISO8601_LAYOUT)}, nil
+	case []byte:
+		return map[string]interface{}{
+			jsonBase64: base64.StdEncoding.EncodeToString(t)}, nil
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, a := range t {
+			var err error
+			if arr[i], err = ToJSONValue(a); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		escape := false
+		for k, a := range t {
+			var err error
+			if m[k], err = ToJSONValue(a); err != nil {
+				return nil, err
+			}
+			escape = escape || strings.HasPrefix(k, "$")
+		}
+		if escape {
+			return map[string]interface{}{jsonStruct: m}, nil
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("Cannot convert %T to JSON", v)
+}
+
+// FromJSONValue converts a value in the typed JSON notation, decoded
+// with json.Decoder.UseNumber, back into what Unmarshal would give
+func FromJSONValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, bool, string:
+		return t, nil
+	case json.Number:
+		s := string(t)
+		if strings.ContainsAny(s, ".eE") {
+			return strconv.ParseFloat(s, 64)
+		}
+		return strconv.Atoi(s)
+	case float64:
+		return t, nil
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, a := range t {
+			var err error
+			if arr[i], err = FromJSONValue(a); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case map[string]interface{}:
+		if len(t) == 1 {
+			for k, a := range t {
+				if strings.HasPrefix(k, "$") {
+					return fromJSONTyped(k, a)
+				}
+			}
+		}
+		return fromJSONStruct(t)
+	}
+	return nil, fmt.Errorf("Cannot convert %T from JSON", v)
+}
+
+func fromJSONStruct(t map[string]interface{}) (interface{}, error) {
+	m := make(map[string]interface{}, len(t))
+	for k, a := range t {
+		var err error
+		if m[k], err = FromJSONValue(a); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// decode a {"$type": value} object
+func fromJSONTyped(typ string, v interface{}) (interface{}, error) {
+	if typ == jsonStruct {
+		if m, ok := v.(map[string]interface{}); ok {
+			return fromJSONStruct(m)
+		}
+		return nil, fmt.Errorf("%s needs an object, got %T", typ, v)
+	}
+	if typ == jsonDouble {
+		if n, ok := v.(json.Number); ok {
+			return strconv.ParseFloat(string(n), 64)
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string, got %T", typ, v)
+	}
+	switch typ {
+	case jsonDouble:
+		return strconv.ParseFloat(s, 64)
+	case jsonDateTime:
+		return time.Parse(ISO8601_LAYOUT, s)
+	case jsonBase64:
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("Unknown JSON value type %s", typ)
+}
+
+type jsonDocument struct {
+	MethodName *string                    `json:"methodName,omitempty"`
+	Params     json.RawMessage            `json:"params,omitempty"`
+	Fault      map[string]json.RawMessage `json:"fault,omitempty"`
+}
+
+// write a JSON value with the object members sorted, so the same
+// document always gives the same bytes
+func writeJSON(w *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case []interface{}:
+		w.WriteByte('[')
+		for i, a := range t {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeJSON(w, a); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+		return nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeJSON(w, k); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+			if err := writeJSON(w, t[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+		return nil
+	}
+	b := bytes.NewBufferString("")
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	w.Write(bytes.TrimRight(b.Bytes(), "\n"))
+	return nil
+}
+
+// MessageToJSON converts a decoded methodCall (methodName is not empty)
+// or methodResponse into its canonical JSON form
+func MessageToJSON(methodName string, params []interface{},
+	fault *Fault) ([]byte, error) {
+	doc := make(map[string]interface{})
+	if fault != nil {
+		fv := make(map[string]interface{})
+		for k, v := range fault.Extra() {
+			var err error
+			if fv[k], err = ToJSONValue(v); err != nil {
+				return nil, err
+			}
+		}
+		fv["faultCode"] = json.Number(strconv.Itoa(fault.Code))
+		fv["faultString"] = fault.Msg
+		doc["fault"] = fv
+	} else {
+		if params == nil {
+			params = []interface{}{}
+		}
+		p, err := ToJSONValue(params)
+		if err != nil {
+			return nil, err
+		}
+		doc["params"] = p
+	}
+	if methodName != "" {
+		doc["methodName"] = methodName
+	}
+
+	buf := bytes.NewBufferString("")
+	if err := writeJSON(buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MessageFromJSON is the reverse of MessageToJSON
+func MessageFromJSON(b []byte) (string, []interface{}, *Fault, error) {
+	var doc jsonDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return "", nil, nil, err
+	}
+
+	var methodName string
+	if doc.MethodName != nil {
+		methodName = *doc.MethodName
+	}
+	if doc.Fault != nil {
+		f, err := faultFromJSON(doc.Fault)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return methodName, nil, f, nil
+	}
+
+	var raw interface{}
+	if len(doc.Params) > 0 {
+		if err := decodeJSON(doc.Params, &raw); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	v, err := FromJSONValue(raw)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	params, ok := v.([]interface{})
+	if !ok && v != nil {
+		return "", nil, nil, errors.New("JSON params must be an array")
+	}
+	return methodName, params, nil, nil
+}
+
+// the fault of a JSON document, with its extra members
+func faultFromJSON(members map[string]json.RawMessage) (*Fault, error) {
+	f := &Fault{}
+	for k, raw := range members {
+		var err error
+		switch k {
+		case "faultCode":
+			err = json.Unmarshal(raw, &f.Code)
+		case "faultString":
+			err = json.Unmarshal(raw, &f.Msg)
+		default:
+			var v interface{}
+			if err = decodeJSON(raw, &v); err == nil {
+				v, err = FromJSONValue(v)
+			}
+			if f.extra == nil {
+				f.extra = &faultExtra{members: make(map[string]interface{})}
+			}
+			f.extra.members[k] = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Bad fault member %s: %v", k, err)
+		}
+	}
+	return f, nil
+}
+
+// XMLToJSON decodes an XML-RPC methodCall or methodResponse and returns
+// its canonical JSON form
+func XMLToJSON(r io.Reader) ([]byte, error) {
+	methodName, params, err, fault := Unmarshal(r)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := params.([]interface{})
+	return MessageToJSON(methodName, p, fault)
+}
+
+// JSONToXML writes the XML-RPC document for the JSON form in b
+func JSONToXML(w io.Writer, b []byte) error {
+	methodName, params, fault, err := MessageFromJSON(b)
+	if err != nil {
+		return err
+	}
+	if fault != nil {
+		defaultEncoder.writeFaultExtra(w, fault.Code, fault.Msg, fault.Extra())
+		return nil
+	}
+	return marshalArray(w, methodName, params)
+}
+
+type gateway struct {
+	client *Client
+}
+
+// NewGateway returns an http.Handler which accepts JSON-RPC 2.0 calls,
+// single or batched, and forwards them to the XML-RPC server behind c.
+// Params and results use the typed JSON notation, so base64 and dateTime
+// values survive the trip. The trace context of the JSON-RPC request is
+// passed on to the XML-RPC calls.
+func NewGateway(c *Client) http.Handler {
+	return &gateway{client: c}
+}
+
+func (g *gateway) call(ctx context.Context, raw json.RawMessage) interface{} {
+	jreq, jf := parseJSONRequest(raw)
+	if jf != nil {
+		return jf
+	}
+	id := jreq.ID
+
+	var args []interface{}
+	if len(jreq.Params) > 0 {
+		var p interface{}
+		err := decodeJSON(jreq.Params, &p)
+		if err == nil {
+			p, err = FromJSONValue(p)
+		}
+		if err != nil {
+			return newJSONFault(id, errInvalidParams,
+				fmt.Sprintf("Invalid params: %v", err))
+		}
+		switch v := p.(type) {
+		case nil:
+		case []interface{}:
+			args = v
+		default:
+			args = []interface{}{v}
+		}
+	}
+
+	result, err, fault := g.client.RPCCallContext(ctx, jreq.Method, args...)
+	if id == nil {
+		return nil
+	}
+	if err != nil {
+		return newJSONFault(id, errInternal, err.Error())
+	} else if fault != nil {
+		return newJSONFault(id, fault.Code, fault.Msg)
+	}
+
+	if params, ok := result.([]interface{}); ok {
+		result = extractParams(params)
+	}
+	jv, err := ToJSONValue(result)
+	if err != nil {
+		return newJSONFault(id, errInternal, err.Error())
+	}
+	return &jsonResult{Version: "2.0", Result: jv, ID: id}
+}
+
+func (g *gateway) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	b, _ := ioutil.ReadAll(req.Body)
+	ctx := extractTrace(req.Context(), req.Header)
+	serveJSONBody(resp, b, func(raw json.RawMessage) interface{} {
+		return g.call(ctx, raw)
+	})
+}
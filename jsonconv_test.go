@@ -0,0 +1,139 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONConversion(t *testing.T) {
+	when, _ := time.Parse(ISO8601_LAYOUT, "19980717T14:08:55")
+	params := []interface{}{
+		1, 1.0, -2.5e-7, "a<b&c", true, nil, when,
+		[]byte{0, 1, 2, 255},
+		[]interface{}{1, "two", []interface{}{}},
+		map[string]interface{}{"x": 1, "y": map[string]interface{}{}},
+		map[string]interface{}{"$base64": "not base64"},
+	}
+
+	buf := bytes.NewBufferString("")
+	if err := Marshal(buf, "test.method", params...); err != nil {
+		t.Fatal(err)
+	}
+	j, err := XMLToJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"methodName":"test.method","params":[1,1.0,-2.5e-07,` +
+		`"a<b&c",true,null,` +
+		`{"$dateTime.iso8601":"19980717T14:08:55"},{"$base64":"AAEC/w=="},` +
+		`[1,"two",[]],{"x":1,"y":{}},{"$struct":{"$base64":"not base64"}}]}`
+	if string(j) != expect {
+		t.Fatalf("XMLToJSON gave\n%s\nwant\n%s", j, expect)
+	}
+
+	buf.Reset()
+	if err = JSONToXML(buf, j); err != nil {
+		t.Fatal(err)
+	}
+	name, back, err, f := Unmarshal(buf)
+	if err != nil || f != nil || name != "test.method" {
+		t.Fatalf("Unmarshal gave %q %v %v", name, err, f)
+	}
+	j2, err := MessageToJSON(name, back.([]interface{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(j2) != expect {
+		t.Errorf("round trip gave\n%s\nwant\n%s", j2, expect)
+	}
+
+	_, p, _, err := MessageFromJSON(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, params) {
+		t.Errorf("MessageFromJSON gave %#v", p)
+	}
+
+	j, err = MessageToJSON("", nil, NewFault(3, "bad"))
+	if err != nil || string(j) != `{"fault":{"faultCode":3,"faultString":"bad"}}` {
+		t.Errorf("fault gave %s %v", j, err)
+	}
+}
+
+func TestJSONFaultExtra(t *testing.T) {
+	doc := `<methodResponse><fault><value><struct>` +
+		`<member><name>faultCode</name><value><int>4</int></value></member>` +
+		`<member><name>faultString</name><value>Too many</value></member>` +
+		`<member><name>trace</name><value><array><data><value>a</value>` +
+		`<value><int>2</int></value></data></array></value></member>` +
+		`<member><name>blob</name><value><base64>AAE=</base64></value></member>` +
+		`</struct></value></fault></methodResponse>`
+	j, err := XMLToJSON(bytes.NewBufferString(doc))
+	expect := `{"fault":{"blob":{"$base64":"AAE="},"faultCode":4,` +
+		`"faultString":"Too many","trace":["a",2]}}`
+	if err != nil || string(j) != expect {
+		t.Fatalf("got %s, %v", j, err)
+	}
+
+	buf := bytes.NewBufferString("")
+	if err = JSONToXML(buf, j); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err, f := Unmarshal(bytes.NewReader(buf.Bytes()))
+	if err != nil || f == nil || f.Code != 4 || f.Msg != "Too many" ||
+		!reflect.DeepEqual(f.Extra(), map[string]interface{}{
+			"trace": []interface{}{"a", 2}, "blob": []byte{0, 1}}) {
+		t.Fatalf("got %v, %#v from\n%s", err, f.Extra(), buf)
+	}
+	if j2, err := XMLToJSON(buf); err != nil || string(j2) != expect {
+		t.Errorf("round trip gave %s, %v", j2, err)
+	}
+}
+
+// some servers send NaN and infinities, which convert to JSON but cannot
+// be written back
+func TestJSONNonFinite(t *testing.T) {
+	doc := `<methodResponse><params><param><value><double>-Inf</double>` +
+		`</value></param></params></methodResponse>`
+	j, err := XMLToJSON(bytes.NewBufferString(doc))
+	if err != nil || string(j) != `{"params":[{"$double":"-Inf"}]}` {
+		t.Fatalf("got %s, %v", j, err)
+	}
+	if err := JSONToXML(bytes.NewBufferString(""), j); err == nil {
+		t.Error("expected an error for -Inf")
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1)} {
+		if err := Marshal(bytes.NewBufferString(""), "m", f); err == nil {
+			t.Errorf("expected an error for %v", f)
+		}
+		m := &Message{MethodName: "m", Params: []*Value{NewDouble(f)}}
+		if err := MarshalMessage(bytes.NewBufferString(""), m); err == nil {
+			t.Errorf("MarshalMessage: expected an error for %v", f)
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(b []byte) []byte { return append(b, '!') }, "bang", nil)
+	h.RegFunc(func() *Fault { return NewFault(9, "no") }, "fail", nil)
+	backend := httptest.NewServer(h)
+	defer backend.Close()
+
+	c, _ := NewClient(backend.URL)
+	gw := NewGateway(c)
+
+	code, body := jsonCall(t, gw, `[
+		{"jsonrpc": "2.0", "method": "bang", "params": [{"$base64": "aGk="}], "id": 1},
+		{"jsonrpc": "2.0", "method": "fail", "id": 2}]`)
+	expect := `[{"jsonrpc":"2.0","result":{"$base64":"aGkh"},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":9,"message":"no"},"id":2}]`
+	if code != 200 || body != expect {
+		t.Errorf("gateway gave %d %s", code, body)
+	}
+}
@@ -0,0 +1,232 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC 2.0 support, the Handler answers requests with a JSON
+// content type through the same registered methods
+
+type jsonRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type jsonResult struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonFault struct {
+	Version string          `json:"jsonrpc"`
+	Error   *jsonError      `json:"error"`
+	ID      json.RawMessage `json:"id"`
+	limited *Fault          // answered with 429 when not in a batch
+}
+
+var jsonNullID = json.RawMessage("null")
+
+func isJSONRequest(req *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
+
+// turn the values decoded with UseNumber into the types Unmarshal
+// gives, so the methods see the same arguments for both protocols
+func fromJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		s := string(t)
+		if !strings.ContainsAny(s, ".eE") {
+			if i, err := strconv.Atoi(s); err == nil {
+				return i
+			}
+		}
+		f, _ := t.Float64()
+		return f
+	case []interface{}:
+		for i := range t {
+			t[i] = fromJSON(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = fromJSON(t[k])
+		}
+	}
+	return v
+}
+
+func decodeJSON(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// get the arguments of a call, positional params are passed in order
+// and named params are passed as a single struct argument
+func jsonArgs(raw json.RawMessage) ([]interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var params interface{}
+	if err := decodeJSON(raw, &params); err != nil {
+		return nil, err
+	}
+	switch p := fromJSON(params).(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return p, nil
+	case map[string]interface{}:
+		return []interface{}{p}, nil
+	}
+	return nil, fmt.Errorf("params must be an array or an object")
+}
+
+func newJSONFault(id json.RawMessage, code int, msg string) *jsonFault {
+	if id == nil {
+		id = jsonNullID
+	}
+	return &jsonFault{Version: "2.0", Error: &jsonError{Code: code,
+		Message: msg}, ID: id}
+}
+
+// decode and check a single JSON-RPC request
+func parseJSONRequest(raw json.RawMessage) (*jsonRequest, *jsonFault) {
+	var jreq jsonRequest
+	if err := decodeJSON(raw, &jreq); err != nil {
+		return nil, newJSONFault(nil, errInvalidRequest,
+			fmt.Sprintf("Invalid request: %v", err))
+	}
+	if jreq.Version != "2.0" || jreq.Method == "" {
+		return nil, newJSONFault(jreq.ID, errInvalidRequest,
+			"Invalid request: need jsonrpc \"2.0\" and a method")
+	}
+	return &jreq, nil
+}
+
+// run a single JSON-RPC request, returns nil for notifications
+func (h *Handler) callJSON(raw json.RawMessage, req *http.Request,
+	rec *callRecord) interface{} {
+	jreq, jf := parseJSONRequest(raw)
+	if jf != nil {
+		rec.called("", nil, jf.Error.Code)
+		return jf
+	}
+	id := jreq.ID
+
+	args, err := jsonArgs(jreq.Params)
+	if err != nil {
+		rec.called(jreq.Method, nil, errInvalidParams)
+		return newJSONFault(id, errInvalidParams,
+			fmt.Sprintf("Invalid params: %v", err))
+	}
+
+	rec.running = jreq.Method
+	mArray, f := h.call(jreq.Method, args, req)
+	if f != nil {
+		rec.called(jreq.Method, args, f.Code)
+	} else {
+		rec.called(jreq.Method, args, 0)
+	}
+	if id == nil {
+		// a notification gets no answer, even when it fails
+		return nil
+	}
+	if f != nil {
+		if h.logf != nil {
+			h.logf(req, f.Code, f.Msg)
+		}
+		jf := newJSONFault(id, f.Code, f.Msg)
+		if h.tooManyRequests(f) {
+			jf.limited = f
+		}
+		return jf
+	}
+
+	res := &jsonResult{Version: "2.0", ID: id}
+	switch len(mArray) {
+	case 0:
+	case 1:
+		res.Result = mArray[0]
+	default:
+		res.Result = mArray
+	}
+	if _, err = json.Marshal(res.Result); err != nil {
+		msg := fmt.Sprintf("Failed to marshal %s: %v", jreq.Method, err)
+		return newJSONFault(id, errInternal, msg)
+	}
+	return res
+}
+
+// handle a JSON-RPC 2.0 request or batch of requests
+func (h *Handler) serveJSON(resp *callRecord, req *http.Request) {
+	b, _ := ioutil.ReadAll(req.Body)
+	if h.logf != nil {
+		h.logf(req, 0, string(b))
+	}
+
+	serveJSONBody(resp, b, func(raw json.RawMessage) interface{} {
+		return h.callJSON(raw, req, resp)
+	})
+}
+
+// answer the JSON-RPC request or batch in b, call runs a single request
+// and returns nil for notifications
+func serveJSONBody(resp http.ResponseWriter, b []byte,
+	call func(json.RawMessage) interface{}) {
+	var answer interface{}
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(b, &batch); err != nil {
+			answer = newJSONFault(nil, errNotWellFormed,
+				fmt.Sprintf("Parse error: %v", err))
+		} else if len(batch) == 0 {
+			answer = newJSONFault(nil, errInvalidRequest,
+				"Invalid request: empty batch")
+		} else {
+			answers := make([]interface{}, 0, len(batch))
+			for _, raw := range batch {
+				if a := call(raw); a != nil {
+					answers = append(answers, a)
+				}
+			}
+			if len(answers) > 0 {
+				answer = answers
+			}
+		}
+	} else if !json.Valid(b) {
+		answer = newJSONFault(nil, errNotWellFormed, "Parse error")
+	} else {
+		answer = call(b)
+	}
+
+	if answer == nil {
+		resp.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	if jf, ok := answer.(*jsonFault); ok && jf.limited != nil {
+		writeTooManyRequests(resp, jf.limited)
+	}
+	enc := json.NewEncoder(resp)
+	enc.SetEscapeHTML(false)
+	enc.Encode(answer)
+}
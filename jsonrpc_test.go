@@ -0,0 +1,71 @@
+package xmlrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+}
+
+func jsonCall(t *testing.T, h http.Handler, body string) (int, string) {
+	req := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestJSONRPC(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(a, b int) int { return a + b }, "add", nil)
+	h.RegFunc(func(p point) int { return p.X * p.Y }, "area", nil)
+	h.RegFunc(func(s string) (string, int) { return s, len(s) }, "both", nil)
+	h.RegFunc(func() *Fault { return NewFault(42, "nope") }, "fail", nil)
+
+	tests := []struct {
+		body   string
+		expect string
+	}{
+		{`{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1}`,
+			`{"jsonrpc":"2.0","result":3,"id":1}`},
+		{`{"jsonrpc": "2.0", "method": "area", "params": {"X": 3, "Y": 4}, "id": "a"}`,
+			`{"jsonrpc":"2.0","result":12,"id":"a"}`},
+		{`{"jsonrpc": "2.0", "method": "both", "params": ["abc"], "id": 2}`,
+			`{"jsonrpc":"2.0","result":["abc",3],"id":2}`},
+		{`{"jsonrpc": "2.0", "method": "fail", "id": 3}`,
+			`{"jsonrpc":"2.0","error":{"code":42,"message":"nope"},"id":3}`},
+		{`{"jsonrpc": "2.0", "method": "add", "params": [1.5, 2], "id": 4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Bad add argument #0: Cannot assign 1.5 <float64> to int"},"id":4}`},
+		{`{"jsonrpc": "2.0", "method": "nothere", "id": 5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Unknown method \"nothere\""},"id":5}`},
+		{`{"jsonrpc": "2.0", "method": "add"`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`},
+		{`[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request: empty batch"},"id":null}`},
+		{`[{"jsonrpc": "2.0", "method": "add", "params": [1, 1], "id": 1},
+		   {"jsonrpc": "2.0", "method": "add", "params": [5, 5]},
+		   {"jsonrpc": "1.0", "method": "add", "id": 2}]`,
+			`[{"jsonrpc":"2.0","result":2,"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request: need jsonrpc \"2.0\" and a method"},"id":2}]`},
+	}
+	for _, tt := range tests {
+		code, body := jsonCall(t, h, tt.body)
+		if code != http.StatusOK || body != tt.expect {
+			t.Errorf("%s\n got %d %s\nwant %s", tt.body, code, body, tt.expect)
+		}
+		if !json.Valid([]byte(body)) {
+			t.Errorf("invalid JSON answer %s", body)
+		}
+	}
+
+	// a notification gets no answer
+	code, body := jsonCall(t, h, `{"jsonrpc": "2.0", "method": "add", "params": [1, 2]}`)
+	if code != http.StatusNoContent || body != "" {
+		t.Errorf("notification answered %d %q", code, body)
+	}
+}
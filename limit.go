@@ -0,0 +1,226 @@
+package xmlrpc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit caps the calls to a method or a group of methods
+type Limit struct {
+	Rate       float64 // calls per second, 0 means no rate limit
+	Burst      int     // calls which can be made at once within Rate, at least 1
+	Concurrent int     // calls running at the same time, 0 means no cap
+	PerClient  bool    // count the calls of every client identity apart
+}
+
+// Limiter rejects the calls which go over their limits with the fault
+// code -32000, before the method runs. Limits are set for a method name,
+// for a namespace as "name.*", which covers "name.x" and "name.x.y", or
+// for all methods as "*". A call must be within every limit covering it.
+type Limiter struct {
+	// Identity names the client of a request for PerClient limits, the
+	// default is the IP address the request comes from
+	Identity func(req *http.Request) string
+	// TooManyRequests answers rejected calls with the HTTP status 429 and
+	// a Retry-After header instead of 200. A JSON-RPC batch is always
+	// answered with 200, since its other calls may have run.
+	TooManyRequests bool
+
+	mu      sync.Mutex
+	limits  map[string]Limit
+	state   map[limitKey]*limitState
+	sweepAt int
+	now     func() time.Time
+}
+
+type limitKey struct {
+	scope  string
+	client string
+}
+
+type limitState struct {
+	lim     Limit
+	tokens  float64
+	last    time.Time
+	running int
+}
+
+// how many limit states to keep before dropping the idle ones
+const minSweep = 1024
+
+// NewLimiter returns a Limiter without any limit
+func NewLimiter() *Limiter {
+	return &Limiter{
+		limits:  make(map[string]Limit),
+		state:   make(map[limitKey]*limitState),
+		sweepAt: minSweep,
+		now:     time.Now,
+	}
+}
+
+// Set sets the limit of a scope, a zero Limit removes it. Scopes are
+// not case sensitive, like the method names of Handler.Register. The
+// calls running keep counting against the new limit.
+func (l *Limiter) Set(scope string, lim Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	scope = strings.ToLower(scope)
+	if lim == (Limit{}) {
+		delete(l.limits, scope)
+	} else {
+		l.limits[scope] = lim
+	}
+	// a removed limit leaves states without limit, swept once idle
+	for k, st := range l.state {
+		if k.scope == scope {
+			st.lim = lim
+		}
+	}
+}
+
+// SetLimiter makes the handler enforce the limits of l, nil stops it
+func (h *Handler) SetLimiter(l *Limiter) {
+	h.limiter = l
+}
+
+// the scopes covering a method, most specific first
+func limitScopes(method string) []string {
+	scopes := []string{method}
+	for i := strings.LastIndex(method, "."); i > 0; i = strings.LastIndex(method[:i], ".") {
+		scopes = append(scopes, method[:i]+".*")
+	}
+	return append(scopes, "*")
+}
+
+func (l *Limiter) identity(req *http.Request) string {
+	if l.Identity != nil {
+		return l.Identity(req)
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func (st *limitState) refill(now time.Time) {
+	burst := float64(st.lim.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	st.tokens = math.Min(burst, st.tokens+now.Sub(st.last).Seconds()*st.lim.Rate)
+	st.last = now
+}
+
+func (st *limitState) idle() bool {
+	return st.running == 0 &&
+		(st.lim.Rate == 0 || st.tokens >= math.Max(float64(st.lim.Burst), 1))
+}
+
+// reserve a call to method, release must be called once it is done.
+// When the call is rejected the fault says when to try again.
+func (l *Limiter) acquire(method string, req *http.Request) (release func(), f *Fault) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+	now := l.now()
+	var states []*limitState
+	var retry time.Duration
+	client := ""
+	for _, scope := range limitScopes(strings.ToLower(method)) {
+		lim, ok := l.limits[scope]
+		if !ok {
+			continue
+		}
+		key := limitKey{scope: scope}
+		if lim.PerClient {
+			if client == "" {
+				client = l.identity(req)
+			}
+			key.client = client
+		}
+		st := l.state[key]
+		if st == nil {
+			st = &limitState{lim: lim, tokens: math.Max(float64(lim.Burst), 1),
+				last: now}
+			l.state[key] = st
+		}
+		if lim.Rate > 0 {
+			st.refill(now)
+			if st.tokens < 1 {
+				wait := time.Duration((1 - st.tokens) / lim.Rate * float64(time.Second))
+				if wait > retry {
+					retry = wait
+				}
+			}
+		}
+		if lim.Concurrent > 0 && st.running >= lim.Concurrent && retry < time.Second {
+			// no telling when a running call ends
+			retry = time.Second
+		}
+		states = append(states, st)
+	}
+
+	if retry > 0 {
+		secs := int(math.Ceil(retry.Seconds()))
+		return nil, &Fault{Code: errLimited,
+			Msg: fmt.Sprintf("Too many calls to \"%s\", retry in %ds", method, secs),
+			extra: &faultExtra{members: map[string]interface{}{
+				"retryAfter": secs}, limited: true}}
+	}
+	for _, st := range states {
+		if st.lim.Rate > 0 {
+			st.tokens--
+		}
+		st.running++
+	}
+	return func() {
+		l.mu.Lock()
+		for _, st := range states {
+			st.running--
+		}
+		l.mu.Unlock()
+	}, nil
+}
+
+// drop the idle states once there are many, which keeps the per client
+// ones from piling up
+func (l *Limiter) sweep() {
+	if len(l.state) < l.sweepAt {
+		return
+	}
+	now := l.now()
+	for k, st := range l.state {
+		if st.lim.Rate > 0 {
+			st.refill(now)
+		}
+		if st.idle() {
+			delete(l.state, k)
+		}
+	}
+	l.sweepAt = 2 * len(l.state)
+	if l.sweepAt < minSweep {
+		l.sweepAt = minSweep
+	}
+}
+
+// whether f is a rejection of the limiter to answer with 429 Too Many
+// Requests, methods returning the code -32000 themselves are not
+func (h *Handler) tooManyRequests(f *Fault) bool {
+	return f.extra != nil && f.extra.limited && h.limiter != nil &&
+		h.limiter.TooManyRequests
+}
+
+func writeTooManyRequests(resp http.ResponseWriter, f *Fault) {
+	if secs, ok := f.Extra()["retryAfter"].(int); ok {
+		resp.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+	resp.WriteHeader(http.StatusTooManyRequests)
+}
@@ -0,0 +1,187 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitScopes(t *testing.T) {
+	got := limitScopes("reports.monthly.pdf")
+	exp := []string{"reports.monthly.pdf", "reports.monthly.*", "reports.*", "*"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Set("reports.*", Limit{Rate: 2, Burst: 2})
+	l.Set("cheap", Limit{Rate: 1, PerClient: true})
+
+	req := &http.Request{RemoteAddr: "10.0.0.1:5000"}
+	for i := 0; i < 2; i++ {
+		if release, f := l.acquire("reports.monthly", req); f != nil {
+			t.Fatalf("call %d: %v", i, f)
+		} else {
+			release()
+		}
+	}
+	_, f := l.acquire("reports.yearly", req)
+	if f == nil || f.Code != errLimited || f.Extra()["retryAfter"] != 1 {
+		t.Fatalf("got %+v", f)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if _, f := l.acquire("reports.yearly", req); f != nil {
+		t.Errorf("after refill: %v", f)
+	}
+
+	// other methods and other clients are not held back
+	other := &http.Request{RemoteAddr: "10.0.0.2:5000"}
+	if _, f := l.acquire("cheap", req); f != nil {
+		t.Error(f)
+	}
+	if _, f := l.acquire("cheap", req); f == nil {
+		t.Error("second cheap call should be limited")
+	}
+	if _, f := l.acquire("cheap", other); f != nil {
+		t.Error(f)
+	}
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	l := NewLimiter()
+	l.Set("*", Limit{Concurrent: 2})
+	req := &http.Request{RemoteAddr: "10.0.0.1:5000"}
+	r1, _ := l.acquire("a", req)
+	r2, _ := l.acquire("b", req)
+	if _, f := l.acquire("a", req); f == nil || f.Extra()["retryAfter"] != 1 {
+		t.Fatalf("got %+v", f)
+	}
+	r1()
+	if _, f := l.acquire("a", req); f != nil {
+		t.Error(f)
+	}
+	r2()
+}
+
+func TestLimiterSetWhileRunning(t *testing.T) {
+	l := NewLimiter()
+	l.Set("report", Limit{Concurrent: 1})
+	req := &http.Request{RemoteAddr: "10.0.0.1:5000"}
+	release, f := l.acquire("report", req)
+	if f != nil {
+		t.Fatal(f)
+	}
+
+	// the running call still counts against the changed limit
+	l.Set("report", Limit{Concurrent: 1, Rate: 100, Burst: 10})
+	if _, f := l.acquire("report", req); f == nil {
+		t.Error("expected a fault")
+	}
+	release()
+	r, f := l.acquire("report", req)
+	if f != nil {
+		t.Fatal(f)
+	}
+	r()
+
+	l.Set("report", Limit{})
+	for i := 0; i < 3; i++ {
+		if _, f := l.acquire("report", req); f != nil {
+			t.Fatal(f)
+		}
+	}
+}
+
+// method names and scopes are matched like the aliases of Register
+func TestLimiterCase(t *testing.T) {
+	l := NewLimiter()
+	l.Set("system.listMethods", Limit{Concurrent: 1})
+	l.Set("Reports.*", Limit{Concurrent: 1})
+	req := &http.Request{RemoteAddr: "10.0.0.1:5000"}
+	for _, names := range [][2]string{
+		{"system.listMethods", "system.listmethods"},
+		{"reports.daily", "REPORTS.Weekly"},
+	} {
+		if _, f := l.acquire(names[0], req); f != nil {
+			t.Fatal(f)
+		}
+		if _, f := l.acquire(names[1], req); f == nil {
+			t.Errorf("%s: expected a fault", names[1])
+		}
+	}
+}
+
+func TestHandlerLimiter(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() int { return 1 }, "report", nil)
+	h.RegFunc(func() *Fault { return NewFault(errLimited, "busy") }, "busy", nil)
+	l := NewLimiter()
+	l.Set("report", Limit{Rate: 0.1})
+	h.SetLimiter(l)
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err, f := c.RPCCall("report"); err != nil || f != nil {
+		t.Fatal(err, f)
+	}
+	_, err, f := c.RPCCall("report")
+	if err != nil || f == nil || f.Code != errLimited {
+		t.Fatalf("got %v, %+v", err, f)
+	}
+
+	l.TooManyRequests = true
+	body := `<methodCall><methodName>report</methodName><params/></methodCall>`
+	resp, err := http.Post(s.URL, "text/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests ||
+		resp.Header.Get("Retry-After") != "10" {
+		t.Errorf("got %d, Retry-After %q", resp.StatusCode,
+			resp.Header.Get("Retry-After"))
+	}
+
+	// JSON-RPC calls get 429 as well, but not in a batch
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc":"2.0","method":"report","id":1}`, http.StatusTooManyRequests},
+		{`[{"jsonrpc":"2.0","method":"report","id":1}]`, http.StatusOK},
+	} {
+		resp, err = http.Post(s.URL, "application/json",
+			strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := new(bytes.Buffer)
+		b.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code || !strings.Contains(b.String(), "-32000") {
+			t.Errorf("%s: got %d %s", tt.body, resp.StatusCode, b)
+		}
+	}
+
+	// a method failing with -32000 itself is not rejected by the limiter
+	body = `<methodCall><methodName>busy</methodName><params/></methodCall>`
+	if resp, err = http.Post(s.URL, "text/xml", strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("a fault of the method got %d", resp.StatusCode)
+	}
+}
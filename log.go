@@ -0,0 +1,127 @@
+package xmlrpc
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LogOptions says what SetLogger adds to the fields always logged
+type LogOptions struct {
+	// Params logs the decoded params of every call, which may hold
+	// secrets, so it is off by default
+	Params bool
+	// Redact lists by method name the indexes of params which are
+	// logged as "[REDACTED]", such as passwords or tokens
+	Redact map[string][]int
+}
+
+// SetLogger makes the handler log every request to l, with the method
+// name, duration, fault code, remote address, request ID (from the
+// X-Request-Id header) and request and response sizes as fields.
+// Requests which end in a fault are logged at level Warn, others at Info.
+// A nil l stops the logging.
+func (h *Handler) SetLogger(l *slog.Logger, opts *LogOptions) {
+	h.logger = l
+	h.logOpts = LogOptions{}
+	if opts != nil {
+		h.logOpts = *opts
+	}
+}
+
+// a ResponseWriter recording what happened to a request, for the logs
+type callRecord struct {
+	http.ResponseWriter
+	req      *http.Request
+	start    time.Time
+	methods  []string
+	codes    []int         // fault code of each call, or 0
+	params   []interface{} // of the last call
+	code     int           // of the first fault
+	running  string        // the method being called, until it returns
+	reqSize  int64
+	respSize int64
+}
+
+func newCallRecord(resp http.ResponseWriter, req *http.Request) *callRecord {
+	rec := &callRecord{ResponseWriter: resp, req: req, start: time.Now()}
+	if req.Body != nil {
+		req.Body = &countingBody{ReadCloser: req.Body, n: &rec.reqSize}
+	}
+	return rec
+}
+
+func (rec *callRecord) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.respSize += int64(n)
+	return n, err
+}
+
+// note a call to method, which gave the fault code or 0
+func (rec *callRecord) called(method string, params []interface{}, code int) {
+	rec.running = ""
+	rec.methods = append(rec.methods, method)
+	rec.codes = append(rec.codes, code)
+	rec.params = params
+	if rec.code == 0 {
+		rec.code = code
+	}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.n += int64(n)
+	return n, err
+}
+
+const redacted = "[REDACTED]"
+
+// copy params, hiding the ones listed for method
+func (o *LogOptions) redact(method string, params []interface{}) []interface{} {
+	idx := o.Redact[method]
+	if len(idx) == 0 {
+		return params
+	}
+	out := append([]interface{}(nil), params...)
+	for _, i := range idx {
+		if i >= 0 && i < len(out) {
+			out[i] = redacted
+		}
+	}
+	return out
+}
+
+func (h *Handler) logCall(rec *callRecord) {
+	if h.logger == nil {
+		return
+	}
+
+	method := strings.Join(rec.methods, ",")
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.Duration("duration", time.Since(rec.start)),
+		slog.String("remote_addr", rec.req.RemoteAddr),
+		slog.Int64("request_size", rec.reqSize),
+		slog.Int64("response_size", rec.respSize),
+	}
+	if id := rec.req.Header.Get("X-Request-Id"); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	level := slog.LevelInfo
+	if rec.code != 0 {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Int("fault_code", rec.code))
+	}
+	if h.logOpts.Params && len(rec.methods) == 1 {
+		attrs = append(attrs, slog.Any("params",
+			h.logOpts.redact(method, rec.params)))
+	}
+	h.logger.LogAttrs(rec.req.Context(), level, "xmlrpc call", attrs...)
+}
@@ -0,0 +1,86 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerLogger(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(user, password string) string { return "hi " + user },
+		"login", nil)
+	out := bytes.NewBufferString("")
+	logger := slog.New(slog.NewJSONHandler(out, nil))
+
+	serve := func(body, contentType string) map[string]interface{} {
+		out.Reset()
+		req := httptest.NewRequest("POST", "/RPC2", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Request-Id", "req-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: %q", err, out.String())
+		}
+		if entry["response_size"] != float64(w.Body.Len()) {
+			t.Errorf("response_size %v, body %d", entry["response_size"],
+				w.Body.Len())
+		}
+		return entry
+	}
+
+	call := `<methodCall><methodName>login</methodName><params>` +
+		`<param><value>bob</value></param><param><value>s3cret</value></param>` +
+		`</params></methodCall>`
+
+	h.SetLogger(logger, nil)
+	e := serve(call, "text/xml")
+	if e["msg"] != "xmlrpc call" || e["level"] != "INFO" ||
+		e["method"] != "login" || e["request_id"] != "req-1" ||
+		e["remote_addr"] != "192.0.2.1:1234" ||
+		e["request_size"] != float64(len(call)) {
+		t.Errorf("got %v", e)
+	}
+	if _, ok := e["duration"]; !ok {
+		t.Error("no duration")
+	}
+	if _, ok := e["params"]; ok || strings.Contains(out.String(), "s3cret") {
+		t.Errorf("params logged by default: %s", out.String())
+	}
+
+	h.SetLogger(logger, &LogOptions{Params: true,
+		Redact: map[string][]int{"login": {1}}})
+	e = serve(call, "text/xml")
+	if p, _ := e["params"].([]interface{}); len(p) != 2 || p[0] != "bob" ||
+		p[1] != "[REDACTED]" {
+		t.Errorf("params %v", e["params"])
+	}
+
+	e = serve(`<methodCall><methodName>nope</methodName><params/></methodCall>`,
+		"text/xml")
+	if e["level"] != "WARN" || e["fault_code"] != float64(errUnknownMethod) ||
+		e["method"] != "nope" {
+		t.Errorf("got %v", e)
+	}
+
+	e = serve(`[{"jsonrpc":"2.0","method":"login","params":["a","b"],"id":1},`+
+		`{"jsonrpc":"2.0","method":"login","params":[1],"id":2}]`,
+		"application/json")
+	if e["method"] != "login,login" || e["fault_code"] != float64(errInvalidParams) {
+		t.Errorf("got %v", e)
+	}
+
+	h.SetLogger(nil, nil)
+	out.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/",
+		strings.NewReader(call)))
+	if out.Len() != 0 {
+		t.Errorf("logged %s", out.String())
+	}
+}
@@ -0,0 +1,283 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of the calls served by a Handler or made
+// by a Client
+type Metrics interface {
+	// InFlight is called with 1 when a request starts and -1 when it ends
+	InFlight(delta int)
+	// Observe is called once per call when it is done. The calls of a
+	// JSON-RPC batch share the duration and sizes of the whole request.
+	Observe(o Observation)
+}
+
+// Observation describes one finished call
+type Observation struct {
+	Method       string
+	Code         int  // the fault code, 0 when the call succeeded
+	Err          bool // the client got no answer, or could not decode it
+	Duration     time.Duration
+	RequestSize  int64 // bytes of the request body
+	ResponseSize int64 // bytes of the response body
+}
+
+// SetMetrics makes the handler report its requests to m, nil stops it
+func (h *Handler) SetMetrics(m Metrics) {
+	h.metrics = m
+}
+
+// SetMetrics makes the client report its calls to m, nil stops it
+func (c *Client) SetMetrics(m Metrics) {
+	c.metrics = m
+}
+
+func (h *Handler) observe(rec *callRecord) {
+	if h.metrics == nil {
+		return
+	}
+	d := time.Since(rec.start)
+	for i, method := range rec.methods {
+		if rec.codes[i] == errUnknownMethod {
+			// do not let callers make up label values
+			method = ""
+		}
+		h.metrics.Observe(Observation{Method: method, Code: rec.codes[i],
+			Duration: d, RequestSize: rec.reqSize, ResponseSize: rec.respSize})
+	}
+}
+
+var (
+	// upper bounds of the default latency buckets, in seconds
+	defaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1,
+		2.5, 5, 10}
+	// upper bounds of the default size buckets, in bytes
+	defaultSizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144,
+		1048576, 4194304}
+)
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+type faultKey struct {
+	method string
+	code   int
+}
+
+// PrometheusMetrics keeps Metrics in memory and writes them in the
+// Prometheus text format when served over HTTP. Metric names start with
+// "xmlrpc_" and the subsystem given to NewPrometheusMetrics.
+type PrometheusMetrics struct {
+	prefix          string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu       sync.Mutex
+	inFlight int64
+	calls    map[string]uint64
+	faults   map[faultKey]uint64
+	errors   map[string]uint64
+	duration map[string]*histogram
+	reqSize  map[string]*histogram
+	respSize map[string]*histogram
+}
+
+// NewPrometheusMetrics returns Metrics for a Handler (subsystem
+// "server") or a Client (subsystem "client"). durationBuckets are the
+// upper bounds of the latency buckets in seconds, sizeBuckets those of
+// the payload size buckets in bytes, nil for the defaults.
+func NewPrometheusMetrics(subsystem string, durationBuckets,
+	sizeBuckets []float64) *PrometheusMetrics {
+	if durationBuckets == nil {
+		durationBuckets = defaultDurationBuckets
+	}
+	if sizeBuckets == nil {
+		sizeBuckets = defaultSizeBuckets
+	}
+	return &PrometheusMetrics{
+		prefix:          "xmlrpc_" + subsystem + "_",
+		durationBuckets: sortedBounds(durationBuckets),
+		sizeBuckets:     sortedBounds(sizeBuckets),
+		calls:           make(map[string]uint64),
+		faults:          make(map[faultKey]uint64),
+		errors:          make(map[string]uint64),
+		duration:        make(map[string]*histogram),
+		reqSize:         make(map[string]*histogram),
+		respSize:        make(map[string]*histogram),
+	}
+}
+
+func (m *PrometheusMetrics) InFlight(delta int) {
+	m.mu.Lock()
+	m.inFlight += int64(delta)
+	m.mu.Unlock()
+}
+
+func (m *PrometheusMetrics) Observe(o Observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[o.Method]++
+	if o.Code != 0 {
+		m.faults[faultKey{o.Method, o.Code}]++
+	}
+	if o.Err {
+		m.errors[o.Method]++
+	}
+	observeIn(m.duration, o.Method, m.durationBuckets, o.Duration.Seconds())
+	observeIn(m.reqSize, o.Method, m.sizeBuckets, float64(o.RequestSize))
+	observeIn(m.respSize, o.Method, m.sizeBuckets, float64(o.ResponseSize))
+}
+
+// a sorted copy of bounds, which the caller may change afterwards
+func sortedBounds(bounds []float64) []float64 {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return b
+}
+
+func observeIn(hs map[string]*histogram, method string, bounds []float64,
+	v float64) {
+	h := hs[method]
+	if h == nil {
+		h = newHistogram(bounds)
+		hs[method] = h
+	}
+	h.observe(v)
+}
+
+func (m *PrometheusMetrics) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(resp)
+}
+
+// WriteTo writes all the metrics in the Prometheus text format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	// format under the lock, and write once it is released, so that a
+	// slow reader does not hold up the calls being measured
+	var buf bytes.Buffer
+	m.mu.Lock()
+	m.format(&buf)
+	m.mu.Unlock()
+	return buf.WriteTo(w)
+}
+
+// write the metrics to w, with m.mu held
+func (m *PrometheusMetrics) format(w io.Writer) {
+	p := m.prefix
+
+	m.header(w, "in_flight", "gauge", "Requests in progress.")
+	fmt.Fprintf(w, "%sin_flight %d\n", p, m.inFlight)
+
+	m.header(w, "calls_total", "counter", "Calls by method.")
+	for _, method := range sortedKeys(m.calls) {
+		fmt.Fprintf(w, "%scalls_total{method=%s} %d\n", p,
+			quoteLabel(method), m.calls[method])
+	}
+
+	m.header(w, "faults_total", "counter", "Faults by method and code.")
+	fks := make([]faultKey, 0, len(m.faults))
+	for k := range m.faults {
+		fks = append(fks, k)
+	}
+	sort.Slice(fks, func(i, j int) bool {
+		if fks[i].method != fks[j].method {
+			return fks[i].method < fks[j].method
+		}
+		return fks[i].code < fks[j].code
+	})
+	for _, k := range fks {
+		fmt.Fprintf(w, "%sfaults_total{method=%s,code=\"%d\"} %d\n", p,
+			quoteLabel(k.method), k.code, m.faults[k])
+	}
+
+	if len(m.errors) > 0 {
+		m.header(w, "errors_total", "counter",
+			"Calls which got no answer that could be decoded.")
+		for _, method := range sortedKeys(m.errors) {
+			fmt.Fprintf(w, "%serrors_total{method=%s} %d\n", p,
+				quoteLabel(method), m.errors[method])
+		}
+	}
+
+	m.writeHistograms(w, "duration_seconds", "Call latency.", m.duration)
+	m.writeHistograms(w, "request_size_bytes", "Request body sizes.",
+		m.reqSize)
+	m.writeHistograms(w, "response_size_bytes", "Response body sizes.",
+		m.respSize)
+}
+
+func (m *PrometheusMetrics) header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", m.prefix, name, help,
+		m.prefix, name, typ)
+}
+
+func (m *PrometheusMetrics) writeHistograms(w io.Writer, name, help string,
+	hs map[string]*histogram) {
+	m.header(w, name, "histogram", help)
+	for _, method := range sortedKeys(hs) {
+		h := hs[method]
+		label := quoteLabel(method)
+		var cum uint64
+		for i, b := range h.bounds {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s%s_bucket{method=%s,le=\"%s\"} %d\n", m.prefix,
+				name, label, formatFloat(b), cum)
+		}
+		fmt.Fprintf(w, "%s%s_bucket{method=%s,le=\"+Inf\"} %d\n", m.prefix,
+			name, label, h.count)
+		fmt.Fprintf(w, "%s%s_sum{method=%s} %s\n", m.prefix, name, label,
+			formatFloat(h.sum))
+		fmt.Fprintf(w, "%s%s_count{method=%s} %d\n", m.prefix, name, label,
+			h.count)
+	}
+}
+
+// the keys of a map[string]..., sorted
+func sortedKeys(m interface{}) []string {
+	mv := reflect.ValueOf(m)
+	keys := make([]string, 0, mv.Len())
+	for _, k := range mv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
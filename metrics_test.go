@@ -0,0 +1,209 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics("server", nil, nil)
+	m.InFlight(1)
+	m.Observe(Observation{Method: "add", Duration: 20 * time.Millisecond,
+		RequestSize: 100, ResponseSize: 2000})
+	m.Observe(Observation{Method: "add", Code: 4, Duration: 3 * time.Second,
+		RequestSize: 100, ResponseSize: 300})
+	m.Observe(Observation{Method: `we"ird`, Err: true})
+
+	buf := bytes.NewBufferString("")
+	n, err := m.WriteTo(buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatal(n, err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE xmlrpc_server_in_flight gauge",
+		"xmlrpc_server_in_flight 1",
+		`xmlrpc_server_calls_total{method="add"} 2`,
+		`xmlrpc_server_calls_total{method="we\"ird"} 1`,
+		`xmlrpc_server_faults_total{method="add",code="4"} 1`,
+		`xmlrpc_server_errors_total{method="we\"ird"} 1`,
+		"# TYPE xmlrpc_server_duration_seconds histogram",
+		`xmlrpc_server_duration_seconds_bucket{method="add",le="0.025"} 1`,
+		`xmlrpc_server_duration_seconds_bucket{method="add",le="2.5"} 1`,
+		`xmlrpc_server_duration_seconds_bucket{method="add",le="5"} 2`,
+		`xmlrpc_server_duration_seconds_bucket{method="add",le="+Inf"} 2`,
+		`xmlrpc_server_duration_seconds_sum{method="add"} 3.02`,
+		`xmlrpc_server_duration_seconds_count{method="add"} 2`,
+		`xmlrpc_server_request_size_bytes_bucket{method="add",le="256"} 2`,
+		`xmlrpc_server_response_size_bytes_bucket{method="add",le="1024"} 1`,
+		`xmlrpc_server_response_size_bytes_sum{method="add"} 2300`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, out)
+		}
+	}
+}
+
+// remembers what it is given
+type testMetrics struct {
+	inFlight int
+	maxIn    int
+	obs      []Observation
+}
+
+func (m *testMetrics) InFlight(delta int) {
+	m.inFlight += delta
+	if m.inFlight > m.maxIn {
+		m.maxIn = m.inFlight
+	}
+}
+
+func (m *testMetrics) Observe(o Observation) {
+	m.obs = append(m.obs, o)
+}
+
+func TestHandlerClientMetrics(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(a, b int) int { return a + b }, "add", nil)
+	hm := &testMetrics{}
+	h.SetMetrics(hm)
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := &testMetrics{}
+	c.SetMetrics(cm)
+
+	c.RPCCall("add", 1, 2)
+	c.RPCCall("add", 1)
+	c.RPCCall("secret_probe")
+
+	if len(hm.obs) != 3 || len(cm.obs) != 3 {
+		t.Fatalf("server %v, client %v", hm.obs, cm.obs)
+	}
+	if hm.inFlight != 0 || hm.maxIn != 1 || cm.inFlight != 0 || cm.maxIn != 1 {
+		t.Errorf("in flight %d/%d, %d/%d", hm.inFlight, hm.maxIn,
+			cm.inFlight, cm.maxIn)
+	}
+	for i, code := range []int{0, errInvalidParams, errUnknownMethod} {
+		so, co := hm.obs[i], cm.obs[i]
+		if so.Code != code || co.Code != code {
+			t.Errorf("call %d: codes %d, %d", i, so.Code, co.Code)
+		}
+		if so.RequestSize == 0 || so.RequestSize != co.RequestSize ||
+			so.ResponseSize == 0 || so.ResponseSize != co.ResponseSize {
+			t.Errorf("call %d: server %+v, client %+v", i, so, co)
+		}
+	}
+	if hm.obs[0].Method != "add" || hm.obs[2].Method != "" ||
+		cm.obs[2].Method != "secret_probe" {
+		t.Errorf("methods %q %q %q", hm.obs[0].Method, hm.obs[2].Method,
+			cm.obs[2].Method)
+	}
+
+	s.Close()
+	c.RPCCall("add", 1, 2)
+	if o := cm.obs[3]; !o.Err {
+		t.Errorf("got %+v", o)
+	}
+}
+
+// blocks in Write until released
+type stuckWriter struct {
+	started, release chan struct{}
+}
+
+func (w *stuckWriter) Write(b []byte) (int, error) {
+	close(w.started)
+	<-w.release
+	return len(b), nil
+}
+
+func TestPrometheusMetricsBuckets(t *testing.T) {
+	bounds := []float64{1, 0.1}
+	m := NewPrometheusMetrics("client", bounds, []float64{10})
+	bounds[0] = 100
+	m.Observe(Observation{Method: "add", Duration: 500 * time.Millisecond,
+		RequestSize: 5, ResponseSize: 50})
+
+	w := &stuckWriter{started: make(chan struct{}),
+		release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		m.WriteTo(w)
+		close(done)
+	}()
+	<-w.started
+	// a slow reader must not hold up the calls
+	m.Observe(Observation{Method: "add"})
+	close(w.release)
+	<-done
+
+	buf := bytes.NewBufferString("")
+	m.WriteTo(buf)
+	out := buf.String()
+	for _, line := range []string{
+		`xmlrpc_client_duration_seconds_bucket{method="add",le="0.1"} 1`,
+		`xmlrpc_client_duration_seconds_bucket{method="add",le="1"} 2`,
+		`xmlrpc_client_request_size_bytes_bucket{method="add",le="10"} 2`,
+		`xmlrpc_client_response_size_bytes_bucket{method="add",le="10"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, out)
+		}
+	}
+}
+
+// a panicking method is still counted, logged and traced, and the panic
+// goes on to net/http
+func TestHandlerPanic(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() int { panic("boom") }, "boom", nil)
+	hm := &testMetrics{}
+	h.SetMetrics(hm)
+	out := bytes.NewBufferString("")
+	h.SetLogger(slog.New(slog.NewJSONHandler(out, nil)), nil)
+	tr := &testTracer{}
+	h.SetTracer(tr)
+
+	for i, body := range []string{
+		`<methodCall><methodName>boom</methodName><params/></methodCall>`,
+		`{"jsonrpc": "2.0", "method": "boom", "id": 1}`,
+	} {
+		req := httptest.NewRequest("POST", "/RPC2", strings.NewReader(body))
+		if i == 1 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Errorf("recovered %v", p)
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		if hm.inFlight != 0 || len(hm.obs) != i+1 {
+			t.Fatalf("in flight %d, observations %+v", hm.inFlight, hm.obs)
+		}
+		if o := hm.obs[i]; o.Method != "boom" || o.Code != errInternal {
+			t.Errorf("got %+v", o)
+		}
+		if !strings.Contains(out.String(), `"method":"boom"`) ||
+			!strings.Contains(out.String(), `"fault_code":-32603`) {
+			t.Errorf("logged %s", out.String())
+		}
+		out.Reset()
+		if e := tr.spans[i].end; e == nil || e.Method != "boom" ||
+			e.Code != errInternal {
+			t.Errorf("span ended with %+v", e)
+		}
+	}
+}
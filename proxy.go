@@ -0,0 +1,251 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recording and replay of XML-RPC traffic. A Recorder is a proxy which
+// writes every call it forwards as a line of JSON, a Replayer serves the
+// responses of such recordings, which makes it a stand-in for the real
+// server in tests.
+
+// Recording is a call seen by a Recorder
+type Recording struct {
+	Method string `json:"method"`
+	// the params in the typed JSON notation, see ToJSONValue
+	Params   json.RawMessage `json:"params"`
+	Time     time.Time       `json:"time"`
+	Duration time.Duration   `json:"duration"` // in nanoseconds
+	Status   int             `json:"status"`
+	Request  string          `json:"request"`
+	Response string          `json:"response"`
+	Error    string          `json:"error,omitempty"` // the upstream server could not be reached
+}
+
+// Recorder forwards calls to an upstream server and records them
+type Recorder struct {
+	Client *http.Client // used to reach the upstream server
+	// requests with a larger body are refused with the status 413,
+	// NewRecorder sets it to 10 MiB
+	MaxBodySize int64
+
+	upstream string
+	mu       sync.Mutex
+	enc      *json.Encoder
+}
+
+// the MaxBodySize of NewRecorder
+const defaultMaxBodySize = 10 << 20
+
+// NewRecorder returns a proxy to the server at upstream which writes
+// each call it forwards to w
+func NewRecorder(upstream string, w io.Writer) *Recorder {
+	return &Recorder{Client: http.DefaultClient,
+		MaxBodySize: defaultMaxBodySize, upstream: upstream,
+		enc: json.NewEncoder(w)}
+}
+
+// headers which only concern a single connection, see RFC 7230 6.1
+var hopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive",
+	"Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer",
+	"Transfer-Encoding", "Upgrade"}
+
+// remove the hop-by-hop headers from h, with those named in Connection
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func (r *Recorder) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(resp, req.Body,
+		r.MaxBodySize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(resp, err.Error(), status)
+		return
+	}
+	rec := Recording{Time: time.Now(), Request: string(body)}
+	rec.Method, rec.Params = callKey(body)
+
+	out, err := http.NewRequestWithContext(req.Context(), "POST", r.upstream,
+		bytes.NewReader(body))
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out.Header = req.Header.Clone()
+	out.Header.Del("Content-Length")
+	removeHopHeaders(out.Header)
+	// the transport asks for gzip itself and decompresses the answer, so
+	// that the recording holds the XML
+	out.Header.Del("Accept-Encoding")
+
+	up, err := r.Client.Do(out)
+	var respBody []byte
+	if err == nil {
+		respBody, err = io.ReadAll(up.Body)
+		up.Body.Close()
+	}
+	rec.Duration = time.Since(rec.Time)
+	if err != nil {
+		rec.Status = http.StatusBadGateway
+		rec.Error = err.Error()
+		r.write(&rec)
+		http.Error(resp, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rec.Status = up.StatusCode
+	rec.Response = string(respBody)
+	r.write(&rec)
+
+	header := up.Header.Clone()
+	header.Del("Content-Length")
+	removeHopHeaders(header)
+	for k, v := range header {
+		resp.Header()[k] = v
+	}
+	resp.WriteHeader(up.StatusCode)
+	resp.Write(respBody)
+}
+
+func (r *Recorder) write(rec *Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(rec)
+}
+
+// the method name and the params in the typed JSON notation of a
+// methodCall, the params are null when it cannot be decoded
+func callKey(body []byte) (string, json.RawMessage) {
+	methodName, params, err, _ := Unmarshal(bytes.NewReader(body))
+	if err != nil {
+		return methodName, json.RawMessage("null")
+	}
+	jv, err := ToJSONValue(params)
+	if err != nil {
+		return methodName, json.RawMessage("null")
+	}
+	b, _ := json.Marshal(jv)
+	return methodName, b
+}
+
+// the same params always give the same key, whatever their layout
+func normalizeParams(raw json.RawMessage) string {
+	var v interface{}
+	if len(raw) == 0 || decodeJSON(raw, &v) != nil {
+		return string(raw)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// ReadRecordings reads the recordings written by a Recorder
+func ReadRecordings(r io.Reader) ([]Recording, error) {
+	var recs []Recording
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 64<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("Recording line %d: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, s.Err()
+}
+
+// Replayer answers calls with the recorded responses of the calls with
+// the same method and params. Calls recorded several times get their
+// responses in turn, the last one is repeated. Calls which were not
+// recorded get a fault.
+type Replayer struct {
+	mu      sync.Mutex
+	calls   map[string][]*Recording
+	missed  []string
+	replays map[string]int
+}
+
+// NewReplayer returns a Replayer serving recs
+func NewReplayer(recs []Recording) *Replayer {
+	rp := &Replayer{calls: make(map[string][]*Recording),
+		replays: make(map[string]int)}
+	for i := range recs {
+		rp.Add(recs[i])
+	}
+	return rp
+}
+
+// Add adds a recording, served after those of the same call added before
+func (rp *Replayer) Add(rec Recording) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	key := rec.Method + " " + normalizeParams(rec.Params)
+	rp.calls[key] = append(rp.calls[key], &rec)
+}
+
+// Missed returns the calls which had no recording, as method and params
+func (rp *Replayer) Missed() []string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return append([]string(nil), rp.missed...)
+}
+
+func (rp *Replayer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	method, params := callKey(body)
+	key := method + " " + normalizeParams(params)
+
+	rp.mu.Lock()
+	recs := rp.calls[key]
+	var rec *Recording
+	if len(recs) > 0 {
+		n := rp.replays[key]
+		if n >= len(recs) {
+			n = len(recs) - 1
+		}
+		rec = recs[n]
+		rp.replays[key] = n + 1
+	} else {
+		rp.missed = append(rp.missed, key)
+	}
+	rp.mu.Unlock()
+
+	if rec == nil {
+		writeFault(resp, errInternal,
+			fmt.Sprintf("No recording of %s", key))
+		return
+	}
+	if rec.Error != "" {
+		http.Error(resp, rec.Error, http.StatusBadGateway)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/xml")
+	if rec.Status != 0 {
+		resp.WriteHeader(rec.Status)
+	}
+	io.WriteString(resp, rec.Response)
+}
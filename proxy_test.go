@@ -0,0 +1,164 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	n := 0
+	h := NewHandler()
+	h.RegFunc(func(m map[string]int) int {
+		n++
+		return m["a"] + m["b"] + n
+	}, "add", nil)
+	up := httptest.NewServer(h)
+	defer up.Close()
+
+	var log bytes.Buffer
+	proxy := httptest.NewServer(NewRecorder(up.URL, &log))
+	defer proxy.Close()
+
+	c, err := NewClient(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err, f := c.RPCCall("add", map[string]int{"a": 1, "b": 2}); err != nil || f != nil {
+			t.Fatal(err, f)
+		}
+	}
+	c.RPCCall("nothing", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	recs, err := ReadRecordings(strings.NewReader(log.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d recordings\n%s", len(recs), log.String())
+	}
+	r := recs[0]
+	if r.Method != "add" || string(r.Params) != `[{"a":1,"b":2}]` ||
+		r.Status != 200 || r.Duration <= 0 ||
+		!strings.Contains(r.Response, "<int>4</int>") {
+		t.Errorf("got %+v", r)
+	}
+	if string(recs[2].Params) != `[{"$dateTime.iso8601":"20200102T03:04:05"}]` {
+		t.Errorf("got %s", recs[2].Params)
+	}
+
+	// replay without the upstream server, members in another order
+	up.Close()
+	rp := NewReplayer(recs)
+	s := httptest.NewServer(rp)
+	defer s.Close()
+	c, _ = NewClient(s.URL)
+	for _, exp := range []int{4, 5, 5} {
+		res, err, f := c.RPCCall("add", map[string]interface{}{"b": 2, "a": 1})
+		if err != nil || f != nil || res.([]interface{})[0] != exp {
+			t.Errorf("got %v, %v, %v, expected %d", res, err, f, exp)
+		}
+	}
+	if _, _, f := c.RPCCall("nothing", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)); f == nil || f.Code != errUnknownMethod {
+		t.Errorf("got %v", f)
+	}
+	if _, _, f := c.RPCCall("add", 1, 2); f == nil || f.Code != errInternal {
+		t.Errorf("got %v", f)
+	}
+	if m := rp.Missed(); len(m) != 1 || m[0] != "add [1,2]" {
+		t.Errorf("missed %q", m)
+	}
+}
+
+func TestRecorderHeaders(t *testing.T) {
+	var got http.Header
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		req *http.Request) {
+		got = req.Header.Clone()
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-End", "1")
+		io.WriteString(w, "<methodResponse><params/></methodResponse>")
+	}))
+	defer up.Close()
+
+	var log bytes.Buffer
+	r := NewRecorder(up.URL, &log)
+	body := `<methodCall><methodName>m</methodName><params/></methodCall>`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Connection", "X-Hop-Req")
+	req.Header.Set("X-Hop-Req", "1")
+	req.Header.Set("Proxy-Authorization", "Basic eDp5")
+	req.Header.Set("X-End", "1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	for _, name := range []string{"X-Hop-Req", "Proxy-Authorization"} {
+		if got.Get(name) != "" {
+			t.Errorf("%s was forwarded upstream", name)
+		}
+	}
+	for _, name := range []string{"Connection", "X-Hop", "Keep-Alive"} {
+		if w.Header().Get(name) != "" {
+			t.Errorf("%s was sent back", name)
+		}
+	}
+	if got.Get("X-End") != "1" || w.Header().Get("X-End") != "1" {
+		t.Errorf("end-to-end headers lost: %v, %v", got, w.Header())
+	}
+
+	r.MaxBodySize = 10
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d", w.Code)
+	}
+}
+
+// clients such as Python's xmlrpc.client ask for gzip
+func TestRecorderGzip(t *testing.T) {
+	const answer = `<?xml version="1.0"?><methodResponse><params><param>` +
+		`<value><string>caf\xc3\xa9</string></value></param></params></methodResponse>`
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		req *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(w, answer)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, answer)
+		zw.Close()
+	}))
+	defer up.Close()
+
+	var log bytes.Buffer
+	r := NewRecorder(up.URL, &log)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(
+		`<methodCall><methodName>m</methodName><params/></methodCall>`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != answer || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("proxy answered %q, %v", w.Body.String(), w.Header())
+	}
+
+	recs, err := ReadRecordings(&log)
+	if err != nil || len(recs) != 1 || recs[0].Response != answer {
+		t.Fatalf("got %+v, %v", recs, err)
+	}
+	w = httptest.NewRecorder()
+	NewReplayer(recs).ServeHTTP(w, httptest.NewRequest("POST", "/",
+		strings.NewReader(`<methodCall><methodName>m</methodName><params/></methodCall>`)))
+	if w.Body.String() != answer {
+		t.Errorf("replay answered %q", w.Body.String())
+	}
+}
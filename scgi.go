@@ -0,0 +1,319 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// SCGI transport, as spoken by rTorrent and other daemons: the request
+// headers are sent as a netstring of NUL separated names and values,
+// followed by the body, and the answer is a CGI style response.
+
+type scgiTransport struct {
+	network string
+	address string
+}
+
+// NewSCGITransport returns an http.RoundTripper which sends requests to
+// an SCGI server listening on the given network address, for example
+// ("tcp", "localhost:5000") or ("unix", "/var/run/rtorrent.sock").
+//
+// Set it as the Transport of a Client to call XML-RPC over SCGI.
+func NewSCGITransport(network, address string) http.RoundTripper {
+	return &scgiTransport{network: network, address: address}
+}
+
+func (t *scgiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := req.Context()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, t.network, t.address)
+	if err != nil {
+		return nil, err
+	}
+	// a peer which stops answering must not hold the call past its
+	// deadline or cancellation
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	// CONTENT_LENGTH must come first, and SCGI must be present
+	hdr := bytes.NewBufferString("")
+	scgiHeader(hdr, "CONTENT_LENGTH", strconv.Itoa(len(body)))
+	scgiHeader(hdr, "SCGI", "1")
+	scgiHeader(hdr, "REQUEST_METHOD", req.Method)
+	scgiHeader(hdr, "REQUEST_URI", req.URL.RequestURI())
+	scgiHeader(hdr, "SERVER_PROTOCOL", "HTTP/1.1")
+	for k, vs := range req.Header {
+		name := strings.ToUpper(strings.Replace(k, "-", "_", -1))
+		if name != "CONTENT_TYPE" {
+			name = "HTTP_" + name
+		}
+		scgiHeader(hdr, name, strings.Join(vs, ", "))
+	}
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "%d:", hdr.Len())
+	hdr.WriteTo(w)
+	w.WriteByte(',')
+	w.Write(body)
+	if err = w.Flush(); err != nil {
+		return fail(err)
+	}
+
+	r := bufio.NewReader(conn)
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return fail(err)
+	}
+
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header:     http.Header(header),
+		Body:       &scgiBody{Reader: r, conn: conn, stop: stop},
+		// the server closes the connection when the answer is done
+		Close:         true,
+		ContentLength: -1,
+		Request:       req,
+	}
+	if s := header.Get("Status"); s != "" {
+		resp.Status = s
+		code := s
+		if i := strings.IndexByte(s, ' '); i >= 0 {
+			code = s[:i]
+		}
+		if resp.StatusCode, err = strconv.Atoi(code); err != nil {
+			return fail(fmt.Errorf("Bad SCGI status %q", s))
+		}
+	}
+	if s := header.Get("Content-Length"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			resp.ContentLength = n
+			resp.Body = &scgiBody{Reader: io.LimitReader(r, n), conn: conn,
+				stop: stop}
+		}
+	}
+	return resp, nil
+}
+
+func scgiHeader(w *bytes.Buffer, name, value string) {
+	w.WriteString(name)
+	w.WriteByte(0)
+	w.WriteString(value)
+	w.WriteByte(0)
+}
+
+type scgiBody struct {
+	io.Reader
+	conn net.Conn
+	stop func() bool // stops watching the context of the request
+}
+
+func (b *scgiBody) Close() error {
+	b.stop()
+	return b.conn.Close()
+}
+
+// read the netstring with the request headers
+func readSCGIHeaders(r *bufio.Reader) (map[string]string, error) {
+	lenStr, err := r.ReadString(':')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(lenStr[:len(lenStr)-1])
+	if err != nil || n < 0 || n > 1<<20 {
+		return nil, fmt.Errorf("Bad SCGI netstring length %q", lenStr)
+	}
+
+	b := make([]byte, n+1)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if b[n] != ',' {
+		return nil, errors.New("SCGI netstring does not end with ','")
+	}
+
+	fields := strings.Split(string(b[:n]), "\x00")
+	if len(fields)%2 != 1 || fields[len(fields)-1] != "" {
+		return nil, errors.New("Bad SCGI headers")
+	}
+	headers := make(map[string]string)
+	for i := 0; i+1 < len(fields); i += 2 {
+		headers[fields[i]] = fields[i+1]
+	}
+	if headers["SCGI"] != "1" {
+		return nil, errors.New("Missing SCGI header")
+	}
+	return headers, nil
+}
+
+// build the http.Request handed to the handler from the SCGI headers
+func newSCGIRequest(headers map[string]string, r io.Reader) (*http.Request, error) {
+	length, err := strconv.ParseInt(headers["CONTENT_LENGTH"], 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("Bad SCGI CONTENT_LENGTH %q",
+			headers["CONTENT_LENGTH"])
+	}
+
+	method := headers["REQUEST_METHOD"]
+	if method == "" {
+		method = "POST"
+	}
+	uri := headers["REQUEST_URI"]
+	if uri == "" {
+		uri = headers["SCRIPT_NAME"] + headers["PATH_INFO"]
+		if q := headers["QUERY_STRING"]; q != "" {
+			uri += "?" + q
+		}
+	}
+	if uri == "" {
+		uri = "/"
+	}
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method:        method,
+		URL:           u,
+		RequestURI:    uri,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(io.LimitReader(r, length)),
+		ContentLength: length,
+		Host:          headers["HTTP_HOST"],
+	}
+	for k, v := range headers {
+		if k == "CONTENT_TYPE" {
+			req.Header.Set("Content-Type", v)
+		} else if strings.HasPrefix(k, "HTTP_") {
+			name := strings.Replace(k[len("HTTP_"):], "_", "-", -1)
+			req.Header.Set(name, v)
+		}
+	}
+	if addr := headers["REMOTE_ADDR"]; addr != "" {
+		req.RemoteAddr = net.JoinHostPort(addr, headers["REMOTE_PORT"])
+	}
+	return req, nil
+}
+
+// buffers the answer of the handler, then writes it CGI style
+type scgiResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *scgiResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *scgiResponse) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *scgiResponse) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *scgiResponse) writeTo(out io.Writer) error {
+	w.WriteHeader(http.StatusOK)
+	if w.header.Get("Content-Type") == "" {
+		w.header.Set("Content-Type", "text/xml")
+	}
+	w.header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, "Status: %d %s\r\n", w.code, http.StatusText(w.code))
+	w.header.Write(bw)
+	bw.WriteString("\r\n")
+	w.body.WriteTo(bw)
+	return bw.Flush()
+}
+
+func serveSCGIConn(conn net.Conn, h http.Handler) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	resp := &scgiResponse{header: make(http.Header)}
+	// a panicking handler must not take down the server, as net/http
+	// sees to for HTTP
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("xmlrpc: panic serving SCGI %v: %v\n%s",
+				conn.RemoteAddr(), p, debug.Stack())
+			resp = &scgiResponse{header: make(http.Header)}
+			resp.WriteHeader(http.StatusInternalServerError)
+			writeFault(resp, errInternal, fmt.Sprintf("Internal error: %v", p))
+			resp.writeTo(conn)
+		}
+	}()
+
+	headers, err := readSCGIHeaders(r)
+	if err != nil {
+		return
+	}
+	req, err := newSCGIRequest(headers, r)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		writeFault(resp, errNotWellFormed, err.Error())
+	} else {
+		if req.RemoteAddr == "" {
+			req.RemoteAddr = conn.RemoteAddr().String()
+		}
+		h.ServeHTTP(resp, req)
+	}
+	resp.writeTo(conn)
+}
+
+// ServeSCGI accepts SCGI connections on l and hands every request to h,
+// which is normally a *Handler, so the same registered methods can be
+// reached over HTTP and SCGI. It returns when l fails to accept.
+func ServeSCGI(l net.Listener, h http.Handler) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSCGIConn(conn, h)
+	}
+}
@@ -0,0 +1,183 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSCGI(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(req *http.Request, who string) string {
+		return "hello " + who + " from " + req.URL.Path
+	}, "hello", nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeSCGI(l, h)
+
+	c, err := NewClient("scgi://" + l.Addr().String() + "/RPC2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		r, err, f := c.RPCCall("hello", "scgi")
+		if err != nil || f != nil {
+			t.Fatalf("RPCCall failed: %v %v", err, f)
+		}
+		if p := r.([]interface{}); len(p) != 1 || p[0] != "hello scgi from /RPC2" {
+			t.Errorf("RPCCall returned %v", r)
+		}
+	}
+
+	_, err, f := c.RPCCall("nothere")
+	if err != nil || f == nil || f.Code != errUnknownMethod {
+		t.Errorf("expect unknown method fault, got %v %v", err, f)
+	}
+}
+
+func TestSCGIUnixSocket(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(s string) string { return "unix " + s }, "echo", nil)
+
+	path := filepath.Join(t.TempDir(), "scgi.sock")
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeSCGI(l, h)
+
+	c, _ := NewClient("http://localhost/RPC2")
+	c.Transport = NewSCGITransport("unix", path)
+	r, err, f := c.RPCCall("echo", "scgi")
+	if err != nil || f != nil {
+		t.Fatalf("RPCCall failed: %v %v", err, f)
+	}
+	if p := r.([]interface{}); len(p) != 1 || p[0] != "unix scgi" {
+		t.Errorf("RPCCall returned %v", r)
+	}
+}
+
+func TestSCGIMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name, in string
+	}{
+		{"length not a number", "x1:SCGI\x001\x00,"},
+		{"negative length", "-1:,"},
+		{"length over the limit", "2000000:"},
+		{"no ':'", "15"},
+		{"short netstring", "30:SCGI\x001\x00,"},
+		{"missing ','", "7:SCGI\x001\x00;"},
+		{"odd fields", "5:SCGI\x00,"},
+		{"missing SCGI", "7:SCGI\x002\x00,"},
+	} {
+		_, err := readSCGIHeaders(bufio.NewReader(strings.NewReader(tt.in)))
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+
+	for _, cl := range []string{"", "x", "-3"} {
+		headers := map[string]string{"SCGI": "1"}
+		if cl != "" {
+			headers["CONTENT_LENGTH"] = cl
+		}
+		if _, err := newSCGIRequest(headers, strings.NewReader("")); err == nil {
+			t.Errorf("CONTENT_LENGTH %q: no error", cl)
+		}
+	}
+
+	// a request without CONTENT_LENGTH is answered with a fault
+	client, server := net.Pipe()
+	go serveSCGIConn(server, NewHandler())
+	go client.Write([]byte("7:SCGI\x001\x00,"))
+	b, _ := ioutil.ReadAll(client)
+	client.Close()
+	resp := string(b)
+	if !strings.HasPrefix(resp, "Status: 400 ") ||
+		!strings.Contains(resp, "<int>-32700</int>") {
+		t.Errorf("got %q", resp)
+	}
+}
+
+func TestSCGIPanic(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func() int { panic("boom") }, "boom", nil)
+	h.RegFunc(func() int { return 1 }, "one", nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeSCGI(l, h)
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	c, _ := NewClient("scgi://" + l.Addr().String() + "/RPC2")
+	_, err, f := c.RPCCall("boom")
+	if err == nil && (f == nil || f.Code != errInternal) {
+		t.Errorf("expect an internal error, got %v", f)
+	}
+	if r, err, f := c.RPCCall("one"); err != nil || f != nil ||
+		r.([]interface{})[0] != 1 {
+		t.Errorf("server did not survive the panic: %v %v %v", r, err, f)
+	}
+}
+
+// a server which accepts but never answers
+func TestSCGITimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				<-done
+				conn.Close()
+			}()
+		}
+	}()
+
+	c, _ := NewClient("scgi://" + l.Addr().String() + "/RPC2")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err, _ = c.RPCCallContext(ctx, "m"); err == nil {
+		t.Error("expect an error from the deadline")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err, _ = c.RPCCallContext(ctx, "m"); err == nil {
+		t.Error("expect an error from the cancellation")
+	}
+
+	c.Timeout = 50 * time.Millisecond
+	if _, err, _ = c.RPCCall("m"); err == nil {
+		t.Error("expect an error from Client.Timeout")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("calls took %v", d)
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"io"
 	"fmt"
 	"bytes"
+	"errors"
 	"io/ioutil"
     "runtime"
 	"reflect"
+	"sort"
 	"strings"
 	"net/http"
+	"log/slog"
 	"encoding/xml"
+	"encoding/base64"
 )
 
 
@@ -18,18 +22,27 @@ type DFT []interface{}
 
 
 type methodData struct {
-	obj       interface{}
+	obj interface{}
 	//method    reflect.Method
-    ftype       reflect.Type    // function/method type
-    fvalue      reflect.Value   // function/method value
-	padParams   bool
-    dft         DFT
+	ftype     reflect.Type  // function/method type
+	fvalue    reflect.Value // function/method value
+	padParams bool
+	dft       DFT
+	name      string // as registered, Register also adds a lower case alias
+	help      string
 }
 
 // Map from XML-RPC procedure names to Go methods
 type Handler struct {
 	methods map[string]*methodData
-    logf    func(req *http.Request, code int, msg string)
+	logf    func(req *http.Request, code int, msg string)
+	enc     *Encoder
+	logger  *slog.Logger
+	logOpts LogOptions
+	metrics Metrics
+	tracer  Tracer
+	limiter *Limiter
+	docs    *DocOptions
 }
 
 // create a new handler mapping XML-RPC procedure names to Go methods
@@ -49,6 +62,11 @@ func (h *Handler)GetMethodList() (ks []string) {
     return
 }
 
+// SetLogf sets a function called with the raw request body, the
+// arguments of calls and faults.
+//
+// Deprecated: use SetLogger, which logs structured fields and does not
+// log params unless asked to.
 func (h *Handler)SetLogf(logf func(*http.Request, int, string)) {
     h.logf = logf
 }
@@ -79,7 +97,8 @@ func (h *Handler) Register(obj interface{}, mapper func(string) string,
 			}
 		}
 
-		md := &methodData{obj: obj, ftype: m.Type, fvalue: m.Func, padParams: padParams}
+		md := &methodData{obj: obj, ftype: m.Type, fvalue: m.Func,
+			padParams: padParams, name: name}
 		h.methods[name] = md
 		h.methods[strings.ToLower(name)] = md
 	}
@@ -91,33 +110,66 @@ func (h *Handler) Register(obj interface{}, mapper func(string) string,
 // register a func, if name is "", then use func name
 func (h *Handler) RegFunc(f interface{}, name string, dft DFT) error {
 	vo := reflect.ValueOf(f)
-    if vo.Kind() != reflect.Func {
-        panic("RegFunc only register function")
-    }
-    md := &methodData{obj: nil, ftype: vo.Type(), fvalue: vo, dft: dft}
-    if name == "" {
-        // runtime.FuncForPC always return pkg.func_name, so we cut prefix "main."
-        //name = runtime.FuncForPC(vo.Pointer()).Name()[5:]
-        // But when go test, this prefix will be different, so we need LastIndex
-        s := runtime.FuncForPC(vo.Pointer()).Name()
-        i := strings.LastIndexByte(s, '.')
-        if i < 0 {
-            name = s
-        } else {
-            name = s[i + 1:]
-        }
-    }
-    h.methods[name] = md
-    return nil
+	if vo.Kind() != reflect.Func {
+		panic("RegFunc only register function")
+	}
+	md := &methodData{obj: nil, ftype: vo.Type(), fvalue: vo, dft: dft}
+	if name == "" {
+		// runtime.FuncForPC always return pkg.func_name, so we cut prefix "main."
+		//name = runtime.FuncForPC(vo.Pointer()).Name()[5:]
+		// But when go test, this prefix will be different, so we need LastIndex
+		s := runtime.FuncForPC(vo.Pointer()).Name()
+		i := strings.LastIndexByte(s, '.')
+		if i < 0 {
+			name = s
+		} else {
+			name = s[i+1:]
+		}
+	}
+	md.name = name
+	h.methods[name] = md
+	return nil
 }
 
 
 var faultType = reflect.TypeOf((*Fault)(nil))
 
+// ErrorFault returns the fault to send for an error: the *Fault in its
+// chain when there is one, or a fault with code -32500 and the error
+// message. Methods, such as the adapters of xmlrpc-gen, return it to
+// report an error as a fault.
+func ErrorFault(err error) *Fault {
+	var f *Fault
+	if errors.As(err, &f) {
+		return f
+	}
+	return &Fault{Code: errApplication, Msg: err.Error()}
+}
+
 
 // Return an XML-RPC fault
 func writeFault(out io.Writer, code int, msg string) {
-	fmt.Fprintf(out, `<?xml version="1.0"?>
+	defaultEncoder.writeFault(out, code, msg)
+}
+
+// Return an XML-RPC fault in the charset of e. A message which cannot be
+// written as text is sent as <base64> with the InvalidBase64 policy,
+// otherwise the bad characters are replaced, since a fault cannot fail.
+func (e *Encoder) writeFault(out io.Writer, code int, msg string) {
+	e.writeFaultExtra(out, code, msg, nil)
+}
+
+// write a fault with the extra members of its struct, see Fault.Extra
+func (e *Encoder) writeFaultExtra(out io.Writer, code int, msg string,
+	extra map[string]interface{}) {
+	cw, ok := e.charsetWriter(out)
+	if ok {
+		out = cw
+		fmt.Fprintf(out, `<?xml version="1.0" encoding="%s"?>`, e.Charset)
+	} else {
+		fmt.Fprintf(out, `<?xml version="1.0"?>`)
+	}
+	fmt.Fprintf(out, `
 <methodResponse>
   <fault>
 	<value>
@@ -129,167 +181,324 @@ func writeFault(out io.Writer, code int, msg string) {
 		  <member>
 			<name>faultString</name>
 			<value>`, code)
-	err := xml.EscapeText(out, []byte(msg))
+	var err error
+	if e != nil && e.Invalid == InvalidBase64 && !validXMLString(msg) {
+		fmt.Fprintf(out, "<base64>%s</base64>",
+			base64.StdEncoding.EncodeToString([]byte(msg)))
+	} else {
+		err = xml.EscapeText(out, []byte(msg))
+	}
 	fmt.Fprintf(out, `</value>
 		  </member>
-		</struct>
+`)
+	names := make([]string, 0, len(extra))
+	for k := range extra {
+		if k != "faultCode" && k != "faultString" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	es := newEncodeState(e)
+	for _, k := range names {
+		// a member which cannot be written is left out
+		buf := bytes.NewBufferString("")
+		if merr := es.wrapMember(buf, k, reflect.ValueOf(extra[k]), 2); merr != nil {
+			if err == nil {
+				err = merr
+			}
+			continue
+		}
+		buf.WriteTo(out)
+	}
+	fmt.Fprintf(out, `		</struct>
 	</value>
   </fault>
 </methodResponse>`)
+	if ok && err == nil {
+		err = cw.Flush()
+	}
 
 	// XXX dump the error to Stderr for now
-    if err != nil {
-        fmt.Fprintf(os.Stderr, "Cannot write fault#%d(%s): %v\n",
-                    code, msg, err)
-    }
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write fault#%d(%s): %v\n",
+			code, msg, err)
+	}
 }
 
 
 // semi-standard XML-RPC response codes
 const (
-	errNotWellFormed = -32700
-	errUnknownMethod = -32601
-	errInvalidParams = -32602
-	errInternal      = -32603
+	errNotWellFormed  = -32700
+	errInvalidRequest = -32600
+	errUnknownMethod  = -32601
+	errInvalidParams  = -32602
+	errInternal       = -32603
+	errApplication    = -32500 // see ErrorFault
+	errLimited        = -32000 // rejected by the Limiter
 )
 
 
-func (mData *methodData)getVals(methodName string, args []interface{}, req *http.Request) (vals []reflect.Value, f *Fault) {
+// get a value of type t from a decoded argument
+func convertArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	nv := reflect.New(t).Elem()
+	if err := assignValue(nv, arg); err != nil {
+		return reflect.Value{}, err
+	}
+	return nv, nil
+}
 
-    // expecting arg number
-    expArgs := mData.ftype.NumIn()
-    // valus will be used to call function, +1 is for potential req
-	vals = make([]reflect.Value, 0, expArgs + 1)
-    x := 0
 
-    if mData.obj != nil {
-        // this function is a object's method, fill first val with obj
-        vals = append(vals, reflect.ValueOf(mData.obj))
-        x = x + 1
-    }
+func (mData *methodData) getVals(methodName string, args []interface{}, req *http.Request) (vals []reflect.Value, f *Fault) {
 
-    if expArgs > x && reflect.TypeOf(req) == mData.ftype.In(x) {
-        // first request is *http.Request, we fill it
-        vals = append(vals, reflect.ValueOf(req))
-        x = x + 1
-    }
+	// expecting arg number
+	expArgs := mData.ftype.NumIn()
+	// valus will be used to call function, +1 is for potential req
+	vals = make([]reflect.Value, 0, expArgs+1)
+	x := 0
+
+	if mData.obj != nil {
+		// this function is a object's method, fill first val with obj
+		vals = append(vals, reflect.ValueOf(mData.obj))
+		x = x + 1
+	}
 
-    for _, arg := range args {
-        vals = append(vals, reflect.ValueOf(arg))
-    }
+	if expArgs > x && mData.ftype.In(x) == contextType {
+		// the context of the request, with its trace context
+		vals = append(vals, reflect.ValueOf(req.Context()))
+		x = x + 1
+	}
 
+	if expArgs > x && reflect.TypeOf(req) == mData.ftype.In(x) {
+		// first request is *http.Request, we fill it
+		vals = append(vals, reflect.ValueOf(req))
+		x = x + 1
+	}
 
-    ff := func() *Fault {
-        f := Fault{errInvalidParams,
-                   fmt.Sprintf("Bad number of parameters for method \"%s\","+
-                               " (input %d != expect %d)",
-                               methodName, len(args), expArgs - x)}
-        return &f
-    }
+	for i, arg := range args {
+		// convert the decoded argument to the type the function expects,
+		// surplus arguments are reported below
+		pos := len(vals)
+		var t reflect.Type
+		if mData.ftype.IsVariadic() && pos >= expArgs-1 {
+			t = mData.ftype.In(expArgs - 1).Elem()
+		} else if pos < expArgs {
+			t = mData.ftype.In(pos)
+		} else {
+			vals = append(vals, reflect.ValueOf(arg))
+			continue
+		}
+		v, err := convertArg(arg, t)
+		if err != nil {
+			f = &Fault{Code: errInvalidParams,
+				Msg: fmt.Sprintf("Bad %s argument #%d: %v", methodName, i, err)}
+			return
+		}
+		vals = append(vals, v)
+	}
 
-    // input and request match
-    if len(vals) == expArgs { return }
+	ff := func() *Fault {
+		f := Fault{Code: errInvalidParams,
+			Msg: fmt.Sprintf("Bad number of parameters for method \"%s\","+
+				" (input %d != expect %d)",
+				methodName, len(args), expArgs-x)}
+		return &f
+	}
 
-    // can miss one or give more because IsVariadic is true
-    if mData.ftype.IsVariadic() && len(vals) >= expArgs -1 { return }
+	// input and request match
+	if len(vals) == expArgs {
+		return
+	}
 
-    // input more
-    if len(vals) > expArgs {
-        f = ff()
-        return
-    }
+	// can miss one or give more because IsVariadic is true
+	if mData.ftype.IsVariadic() && len(vals) >= expArgs-1 {
+		return
+	}
 
-    dl := len(mData.dft)
+	// input more
+	if len(vals) > expArgs {
+		f = ff()
+		return
+	}
 
-    for i := len(vals); i < expArgs; i++ {
-        if dl > 0 && dl + i >= expArgs {
-            vals = append(vals, reflect.ValueOf(mData.dft[dl - expArgs + i]))
-        } else if mData.padParams {
-            vals = append(vals, reflect.Zero(mData.ftype.In(i)))
-        } else {
-            f = ff()
-            return
-        }
-    }
-    return
+	dl := len(mData.dft)
+
+	for i := len(vals); i < expArgs; i++ {
+		if dl > 0 && dl+i >= expArgs {
+			vals = append(vals, reflect.ValueOf(mData.dft[dl-expArgs+i]))
+		} else if mData.padParams {
+			vals = append(vals, reflect.Zero(mData.ftype.In(i)))
+		} else {
+			f = ff()
+			return
+		}
+	}
+	return
 }
 
 
-// handle an XML-RPC request
+// find the method and call it with args, returns its results or the
+// fault to send back
+func (h *Handler) call(methodName string, args []interface{},
+	req *http.Request) ([]interface{}, *Fault) {
+	// try to find registered function by name
+	mData, ok := h.methods[methodName]
+	if !ok {
+		return nil, &Fault{Code: errUnknownMethod,
+			Msg: fmt.Sprintf("Unknown method \"%s\"", methodName)}
+	}
+
+	if h.limiter != nil {
+		release, f := h.limiter.acquire(methodName, req)
+		if f != nil {
+			return nil, f
+		}
+		defer release()
+	}
+
+	// get values
+	vals, f := mData.getVals(methodName, args, req)
+	if f != nil {
+		return nil, f
+	}
+
+	if h.logf != nil {
+		h.logf(req, 0, fmt.Sprintf("call method %v, input %v", methodName, vals))
+	}
+	// exec function
+	rtnVals := mData.fvalue.Call(vals)
+
+	if len(rtnVals) == 1 && reflect.TypeOf(rtnVals[0].Interface()) == faultType {
+		if fault, ok := rtnVals[0].Interface().(*Fault); ok {
+			return nil, fault
+		}
+	}
+
+	mArray := make([]interface{}, len(rtnVals), len(rtnVals))
+	for i := 0; i < len(rtnVals); i++ {
+		mArray[i] = rtnVals[i].Interface()
+	}
+	return mArray, nil
+}
+
+
+// handle an XML-RPC request, or a JSON-RPC one when the body is JSON, and
+// GET with the documentation page when there is one
 func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-    b, _ := ioutil.ReadAll(req.Body)
-    body := string(b)
-    if h.logf != nil { h.logf(req, 0, body) }
-    methodName, params, err, fault := UnmarshalString(body)
-    //methodName, params, err, fault := Unmarshal(req.Body)
-
-    if err != nil {
-        msg := fmt.Sprintf("Unmarshal error: %v", err)
-        writeFault(resp, errNotWellFormed, msg)
-        if h.logf != nil { h.logf(req, errNotWellFormed, msg) }
-        return
-    } else if fault != nil {
-        writeFault(resp, fault.Code, fault.Msg)
-        if h.logf != nil { h.logf(req, fault.Code, fault.Msg) }
-        return
-	}
-
-    // try to get input arguments
-    var args []interface{}
-    var ok bool
-
-    if args, ok = params.([]interface{}); !ok {
-        args = make([]interface{}, 1, 1)
-        args[0] = params
-    }
+	if h.docs != nil && (req.Method == "GET" || req.Method == "HEAD") {
+		h.serveDocs(resp, req)
+		return
+	}
 
-    // try to find registered function by name
-    var mData *methodData
+	ctx := extractTrace(req.Context(), req.Header)
+	var span Span
+	if h.tracer != nil {
+		ctx, span = h.tracer.StartSpan(ctx, SpanServer, "")
+	}
+	req = req.WithContext(ctx)
 
-    if mData, ok = h.methods[methodName]; !ok {
-        msg := fmt.Sprintf("Unknown method \"%s\"", methodName)
-        writeFault(resp, errUnknownMethod, msg)
-        if h.logf != nil { h.logf(req, errUnknownMethod, msg) }
-        return
-    }
+	rec := newCallRecord(resp, req)
+	if h.metrics != nil {
+		h.metrics.InFlight(1)
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			// a method panicked, which net/http recovers from
+			rec.called(rec.running, nil, errInternal)
+		}
+		if h.metrics != nil {
+			h.metrics.InFlight(-1)
+		}
+		h.logCall(rec)
+		h.observe(rec)
+		if span != nil {
+			span.End(rec.spanEnd())
+		}
+	}()
+	h.serve(rec, req)
+	completed = true
+}
 
-    // get values
-    vals, f := mData.getVals(methodName, args, req)
-    if f != nil {
-        writeFault(resp, f.Code, f.Msg)
-        if h.logf != nil { h.logf(req, f.Code, f.Msg) }
-        return
-    }
+func (h *Handler) serve(resp *callRecord, req *http.Request) {
+	if isJSONRequest(req) {
+		h.serveJSON(resp, req)
+		return
+	}
 
-    if h.logf != nil {
-        h.logf(req, 0, fmt.Sprintf("call method %v, input %v", methodName, vals))
-    }
-    // exec function
-    rtnVals := mData.fvalue.Call(vals)
-
-    if len(rtnVals) == 1 && reflect.TypeOf(rtnVals[0].Interface()) == faultType {
-        if fault, ok := rtnVals[0].Interface().(*Fault); ok {
-            writeFault(resp, fault.Code, fault.Msg)
-            if h.logf != nil { h.logf(req, fault.Code, fault.Msg) }
-            return
-        }
-    }
+	// faults are written in the charset of the encoder as well
+	if h.enc != nil {
+		resp.Header().Set("Content-Type", h.enc.contentType())
+	}
 
-    mArray := make([]interface{}, len(rtnVals), len(rtnVals))
-    for i := 0; i < len(rtnVals); i++ {
-        mArray[i] = rtnVals[i].Interface()
-    }
+	b, _ := ioutil.ReadAll(req.Body)
+	body := string(b)
+	if h.logf != nil {
+		h.logf(req, 0, body)
+	}
+	methodName, params, err, fault := UnmarshalString(body)
+	//methodName, params, err, fault := Unmarshal(req.Body)
 
-    buf := bytes.NewBufferString("")
-    err = marshalArray(buf, "", mArray)
-    if err != nil {
-        msg := fmt.Sprintf("Failed to marshal %s: %v", methodName, err)
-        writeFault(resp, errInternal, msg)
-        if h.logf != nil { h.logf(req, errInternal, "ouput: " + msg) }
-        return
-    }
-    //fmt.Fprintf(os.Stderr, buf.String())
-    buf.WriteTo(resp)
+	if err != nil {
+		msg := fmt.Sprintf("Unmarshal error: %v", err)
+		resp.called(methodName, nil, errNotWellFormed)
+		h.enc.writeFault(resp, errNotWellFormed, msg)
+		if h.logf != nil {
+			h.logf(req, errNotWellFormed, msg)
+		}
+		return
+	} else if fault != nil {
+		resp.called(methodName, nil, fault.Code)
+		h.enc.writeFault(resp, fault.Code, fault.Msg)
+		if h.logf != nil {
+			h.logf(req, fault.Code, fault.Msg)
+		}
+		return
+	}
+
+	// try to get input arguments
+	var args []interface{}
+	var ok bool
+
+	if args, ok = params.([]interface{}); !ok {
+		args = make([]interface{}, 1, 1)
+		args[0] = params
+	}
+
+	resp.running = methodName
+	mArray, f := h.call(methodName, args, req)
+	if f != nil {
+		resp.called(methodName, args, f.Code)
+		if h.tooManyRequests(f) {
+			writeTooManyRequests(resp, f)
+		}
+		h.enc.writeFault(resp, f.Code, f.Msg)
+		if h.logf != nil {
+			h.logf(req, f.Code, f.Msg)
+		}
+		return
+	}
+
+	buf := bytes.NewBufferString("")
+	err = h.enc.marshalArray(buf, "", mArray)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to marshal %s: %v", methodName, err)
+		resp.called(methodName, args, errInternal)
+		h.enc.writeFault(resp, errInternal, msg)
+		if h.logf != nil {
+			h.logf(req, errInternal, "ouput: "+msg)
+		}
+		return
+	}
+	resp.called(methodName, args, 0)
+	//fmt.Fprintf(os.Stderr, buf.String())
+	buf.WriteTo(resp)
 }
 
 
@@ -0,0 +1,155 @@
+package xmlrpc
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Tracing with W3C Trace Context: the Client sends the span context found
+// in the context of a call as traceparent and tracestate headers, and the
+// Handler puts the one it receives in the context passed to methods which
+// take a context.Context. A Tracer adds spans around both.
+
+// SpanContext identifies a span across processes, as carried by the
+// traceparent and tracestate headers
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte   // 1 means sampled
+	State   string // the tracestate header, passed on unchanged
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" +
+		hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header. Versions after 00 are
+// read as far as version 00 goes, as the spec asks.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.New("Bad traceparent " + s)
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, errors.New("Bad traceparent version " + s)
+	}
+	flags, err1 := hex.DecodeString(parts[3])
+	_, err2 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, err3 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	if err1 != nil || err2 != nil || err3 != nil || !sc.IsValid() ||
+		strings.ToLower(s) != s {
+		return SpanContext{}, errors.New("Bad traceparent " + s)
+	}
+	sc.Flags = flags[0]
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// SpanKind says which side of a call a span is for
+type SpanKind int
+
+const (
+	SpanServer SpanKind = iota
+	SpanClient
+)
+
+// A Tracer starts spans. StartSpan gets the context of the call, which
+// carries the parent SpanContext if there is one, and returns a context
+// carrying the SpanContext of the new span, so that it is propagated.
+// The method is empty for the server, which has not decoded the request
+// yet, and is given to End.
+type Tracer interface {
+	StartSpan(ctx context.Context, kind SpanKind, method string) (context.Context, Span)
+}
+
+// A Span is ended once the call is done
+type Span interface {
+	End(e SpanEnd)
+}
+
+// SpanEnd is what is known of a call when its span ends
+type SpanEnd struct {
+	Method       string // for a JSON-RPC batch, the methods joined by ","
+	Code         int    // the fault code, 0 when the call succeeded
+	Err          error  // the client got no answer, or could not decode it
+	RequestSize  int64
+	ResponseSize int64
+}
+
+// SetTracer makes the handler start a span for every request, nil stops it
+func (h *Handler) SetTracer(t Tracer) {
+	h.tracer = t
+}
+
+// SetTracer makes the client start a span for every call, nil stops it
+func (c *Client) SetTracer(t Tracer) {
+	c.tracer = t
+}
+
+// put the span context of the traceparent and tracestate headers in ctx
+func extractTrace(ctx context.Context, header http.Header) context.Context {
+	tp := header.Get("Traceparent")
+	if tp == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		// start a new trace, as the spec says
+		return ctx
+	}
+	sc.State = strings.Join(header.Values("Tracestate"), ",")
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// set the traceparent and tracestate headers from the span context in ctx
+func injectTrace(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+	header.Set("Traceparent", sc.Traceparent())
+	if sc.State != "" {
+		header.Set("Tracestate", sc.State)
+	}
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+func (rec *callRecord) spanEnd() SpanEnd {
+	e := SpanEnd{Method: strings.Join(rec.methods, ","),
+		RequestSize: rec.reqSize, ResponseSize: rec.respSize}
+	for _, code := range rec.codes {
+		if code != 0 {
+			// the first fault of a batch
+			e.Code = code
+			break
+		}
+	}
+	return e
+}
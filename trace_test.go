@@ -0,0 +1,163 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Flags != 1 || sc.SpanID[7] != 0xb7 || sc.Traceparent() != tp {
+		t.Errorf("got %+v", sc)
+	}
+	if _, err := ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what"); err != nil {
+		t.Errorf("future version: %v", err)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("%q should not parse", bad)
+		}
+	}
+}
+
+// starts child spans with sequential span IDs and remembers how they end
+type testTracer struct {
+	mu    sync.Mutex
+	next  byte
+	spans []*testSpan
+}
+
+type testSpan struct {
+	kind   SpanKind
+	parent SpanContext
+	sc     SpanContext
+	end    *SpanEnd
+}
+
+func (tr *testTracer) StartSpan(ctx context.Context, kind SpanKind,
+	method string) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.next++
+	s := &testSpan{kind: kind}
+	s.parent, _ = SpanContextFromContext(ctx)
+	s.sc = s.parent
+	s.sc.TraceID[0] = 1
+	s.sc.SpanID = [8]byte{7: tr.next}
+	tr.spans = append(tr.spans, s)
+	return ContextWithSpanContext(ctx, s.sc), s
+}
+
+func (s *testSpan) End(e SpanEnd) {
+	s.end = &e
+}
+
+func TestTracing(t *testing.T) {
+	var got SpanContext
+	h := NewHandler()
+	h.RegFunc(func(ctx context.Context, a, b int) int {
+		got, _ = SpanContextFromContext(ctx)
+		return a + b
+	}, "add", nil)
+	ht := &testTracer{}
+	h.SetTracer(ht)
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := &testTracer{next: 100}
+	c.SetTracer(ct)
+
+	parent := SpanContext{TraceID: [16]byte{0: 1, 15: 9}, SpanID: [8]byte{0: 5},
+		Flags: 1, State: "vendor=x"}
+	ctx := ContextWithSpanContext(context.Background(), parent)
+	res, err, fault := c.RPCCallContext(ctx, "add", 1, 2)
+	if err != nil || fault != nil || res.([]interface{})[0] != 3 {
+		t.Fatal(res, err, fault)
+	}
+	c.RPCCallContext(ctx, "add", 1)
+
+	if len(ct.spans) != 2 || len(ht.spans) != 2 {
+		t.Fatalf("client %d spans, server %d", len(ct.spans), len(ht.spans))
+	}
+	cs, ss := ct.spans[0], ht.spans[0]
+	if cs.kind != SpanClient || cs.parent != parent {
+		t.Errorf("client span %+v", cs)
+	}
+	// the server continues the trace of the client span
+	if ss.kind != SpanServer || ss.parent != cs.sc {
+		t.Errorf("server span parent %+v, expected %+v", ss.parent, cs.sc)
+	}
+	if got != ss.sc {
+		t.Errorf("method got %+v, expected %+v", got, ss.sc)
+	}
+
+	for i, code := range []int{0, errInvalidParams} {
+		ce, se := ct.spans[i].end, ht.spans[i].end
+		if ce == nil || se == nil {
+			t.Fatalf("call %d: span not ended", i)
+		}
+		if ce.Method != "add" || se.Method != "add" || ce.Code != code ||
+			se.Code != code || se.RequestSize == 0 ||
+			se.RequestSize != ce.RequestSize ||
+			se.ResponseSize != ce.ResponseSize {
+			t.Errorf("call %d: client %+v, server %+v", i, ce, se)
+		}
+	}
+
+	// without a tracer the trace context is passed through
+	c.SetTracer(nil)
+	h.SetTracer(nil)
+	c.RPCCallContext(ctx, "add", 1, 2)
+	if got != parent {
+		t.Errorf("got %+v, expected %+v", got, parent)
+	}
+
+	s.Close()
+	c.SetTracer(ct)
+	c.RPCCallContext(ctx, "add", 1, 2)
+	if e := ct.spans[2].end; e == nil || e.Err == nil {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestGatewayTracing(t *testing.T) {
+	var got SpanContext
+	h := NewHandler()
+	h.RegFunc(func(ctx context.Context) int {
+		got, _ = SpanContextFromContext(ctx)
+		return 1
+	}, "one", nil)
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c, _ := NewClient(s.URL)
+
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("POST", "/",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"one","id":1}`))
+	req.Header.Set("Traceparent", tp)
+	resp := httptest.NewRecorder()
+	NewGateway(c).ServeHTTP(resp, req)
+	if got.Traceparent() != tp {
+		t.Errorf("got %q, response %s", got.Traceparent(), resp.Body)
+	}
+}
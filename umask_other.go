@@ -0,0 +1,8 @@
+//go:build !unix
+
+package xmlrpc
+
+// there is no umask, the permissions of the socket are only set by chmod
+func umask(mask int) int {
+	return 0
+}
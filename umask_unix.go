@@ -0,0 +1,10 @@
+//go:build unix
+
+package xmlrpc
+
+import "syscall"
+
+// set the umask of the process and return the previous one
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
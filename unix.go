@@ -0,0 +1,93 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// the umask is shared by the whole process
+var umaskMu sync.Mutex
+
+// an HTTP transport which connects to the Unix socket at path whatever
+// host the request is for
+func unixTransport(path string) *http.Transport {
+	var d net.Dialer
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil // the socket is the only way to the server
+	t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", path)
+	}
+	return t
+}
+
+// SetDialContext makes the client open its connections with dial, for
+// example to go through a proxy or a custom socket, while keeping the
+// normal HTTP framing
+func (c *Client) SetDialContext(dial func(ctx context.Context, network,
+	addr string) (net.Conn, error)) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dial
+	c.Transport = t
+}
+
+// ListenUnix listens on the Unix domain socket at path and gives it the
+// permissions in mode. A socket left behind by a previous run, which
+// refuses connections, is removed first. A socket still in use or any
+// other kind of file at path is an error.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err = removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// create the socket without more permissions than mode, so nobody
+	// else can connect before the chmod
+	umaskMu.Lock()
+	old := umask(0777 &^ int(mode.Perm()))
+	l, err := net.Listen("unix", path)
+	umask(old)
+	umaskMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// remove the socket at path if nothing listens on it any more
+func removeStaleSocket(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ServeUnix serves h over HTTP on the Unix domain socket at path, see
+// ListenUnix for the meaning of mode. The socket is removed when serving
+// stops.
+func ServeUnix(path string, mode os.FileMode, h http.Handler) error {
+	l, err := ListenUnix(path, mode)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return http.Serve(l, h)
+}
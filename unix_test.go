@@ -0,0 +1,122 @@
+package xmlrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUnixSocket(t *testing.T) {
+	h := NewHandler()
+	h.RegFunc(func(s string) string { return "unix " + s }, "echo", nil)
+
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, h)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode is %v", fi.Mode().Perm())
+	}
+
+	c, err := NewClient("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err, f := c.RPCCall("echo", "hi")
+	if err != nil || f != nil {
+		t.Fatalf("RPCCall failed: %v %v", err, f)
+	}
+	if p := r.([]interface{}); len(p) != 1 || p[0] != "unix hi" {
+		t.Errorf("RPCCall returned %v", r)
+	}
+
+	// any address works when the dialer decides where to connect
+	c, _ = NewClient("http://example.invalid/RPC2")
+	c.SetDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	})
+	if _, err, f = c.RPCCall("echo", "again"); err != nil || f != nil {
+		t.Fatalf("RPCCall with dialer failed: %v %v", err, f)
+	}
+
+	if _, err = NewClient("unix://"); err == nil {
+		t.Errorf("expect an error without socket path")
+	}
+}
+
+func TestListenUnixExisting(t *testing.T) {
+	dir := t.TempDir()
+
+	// a socket left behind by a process which did not clean up
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = ListenUnix(stale, 0600); err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	defer l.Close()
+
+	// the socket is in use now
+	if _, err = ListenUnix(stale, 0600); err == nil {
+		t.Error("expect an error for a socket in use")
+	}
+	if _, err = os.Stat(stale); err != nil {
+		t.Errorf("socket in use was removed: %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err = os.WriteFile(file, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ListenUnix(file, 0600); err == nil {
+		t.Error("expect an error for a regular file")
+	}
+	if b, _ := os.ReadFile(file); string(b) != "keep" {
+		t.Errorf("regular file was changed")
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	c, _ := NewClient("unix:///run/rpc.sock")
+	c2, _ := NewClient("http://localhost/RPC2")
+	c2.SetDialContext((&net.Dialer{}).DialContext)
+	for _, tr := range []http.RoundTripper{c.Transport, c2.Transport} {
+		ht, ok := tr.(*http.Transport)
+		if !ok || ht.TLSHandshakeTimeout == 0 || ht.IdleConnTimeout == 0 ||
+			!ht.ForceAttemptHTTP2 || ht.DialContext == nil {
+			t.Errorf("transport lacks the defaults: %+v", tr)
+		}
+	}
+	if c2.Transport.(*http.Transport).Proxy == nil {
+		t.Error("SetDialContext dropped the proxy")
+	}
+
+	// ListenUnix puts the umask of the process back
+	old := umask(022)
+	defer umask(old)
+	l, err := ListenUnix(filepath.Join(t.TempDir(), "rpc.sock"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if m := umask(022); runtime.GOOS != "windows" && m != 022 {
+		t.Errorf("umask is %o", m)
+	}
+}
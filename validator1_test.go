@@ -0,0 +1,150 @@
+package xmlrpc
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The UserLand validator1 suite, which XML-RPC servers have long been
+// checked with, run against a Handler.
+
+type stooges struct {
+	Moe, Larry, Curly int
+}
+
+func arrayOfStructsTest(list []stooges) int {
+	sum := 0
+	for _, s := range list {
+		sum += s.Curly
+	}
+	return sum
+}
+
+func countTheEntities(s string) map[string]int {
+	return map[string]int{
+		"ctLeftAngleBrackets":  strings.Count(s, "<"),
+		"ctRightAngleBrackets": strings.Count(s, ">"),
+		"ctAmpersands":         strings.Count(s, "&"),
+		"ctApostrophes":        strings.Count(s, "'"),
+		"ctQuotes":             strings.Count(s, `"`),
+	}
+}
+
+func easyStructTest(s stooges) int {
+	return s.Moe + s.Larry + s.Curly
+}
+
+func echoStructTest(s map[string]interface{}) map[string]interface{} {
+	return s
+}
+
+func manyTypesTest(n int, b bool, s string, d float64, t time.Time,
+	data []byte) []interface{} {
+	return []interface{}{n, b, s, d, t, data}
+}
+
+func moderateSizeArrayCheck(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0] + list[len(list)-1]
+}
+
+func nestedStructTest(years map[string]map[string]map[string]stooges) int {
+	s := years["2000"]["04"]["01"]
+	return s.Moe + s.Larry + s.Curly
+}
+
+func simpleStructReturnTest(n int) map[string]int {
+	return map[string]int{"times10": n * 10, "times100": n * 100,
+		"times1000": n * 1000}
+}
+
+func validator1Client(t *testing.T) *Client {
+	h := NewHandler()
+	for name, f := range map[string]interface{}{
+		"arrayOfStructsTest":     arrayOfStructsTest,
+		"countTheEntities":       countTheEntities,
+		"easyStructTest":         easyStructTest,
+		"echoStructTest":         echoStructTest,
+		"manyTypesTest":          manyTypesTest,
+		"moderateSizeArrayCheck": moderateSizeArrayCheck,
+		"nestedStructTest":       nestedStructTest,
+		"simpleStructReturnTest": simpleStructReturnTest,
+	} {
+		if err := h.RegFunc(f, "validator1."+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestValidator1(t *testing.T) {
+	c := validator1Client(t)
+	call := func(method string, exp interface{}, args ...interface{}) {
+		t.Helper()
+		reply := reflect.New(reflect.TypeOf(exp))
+		if err := c.Call("validator1."+method, reply.Interface(),
+			args...); err != nil {
+			t.Errorf("%s: %v", method, err)
+		} else if got := reply.Elem().Interface(); !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: got %#v, expected %#v", method, got, exp)
+		}
+	}
+
+	call("arrayOfStructsTest", 6, []interface{}{
+		map[string]int{"moe": 1, "larry": 2, "curly": 3},
+		map[string]int{"moe": 0, "larry": -2, "curly": -1},
+		map[string]int{"moe": 5, "larry": 5, "curly": 4},
+	})
+
+	call("countTheEntities", map[string]int{"ctLeftAngleBrackets": 2,
+		"ctRightAngleBrackets": 1, "ctAmpersands": 3, "ctApostrophes": 2,
+		"ctQuotes": 2}, `<a href="x">&amp;&lt; 'q' & <`)
+
+	call("easyStructTest", 12,
+		map[string]int{"moe": 3, "larry": 4, "curly": 5})
+
+	echo := map[string]interface{}{"substruct0": map[string]interface{}{
+		"moe": 1, "larry": 2, "curly": 3}, "name": "stooges",
+		"list": []interface{}{1, "x", true}}
+	call("echoStructTest", echo, echo)
+
+	when := time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC)
+	data := []byte("you can't read this!")
+	call("manyTypesTest",
+		[]interface{}{17, false, "Hello & bye", 3.14, when, data},
+		17, false, "Hello & bye", 3.14, when, data)
+
+	list := make([]string, 150)
+	for i := range list {
+		list[i] = strings.Repeat("x", i%17)
+	}
+	list[0], list[149] = "first", "last"
+	call("moderateSizeArrayCheck", "firstlast", list)
+
+	day := func(moe, larry, curly int) map[string]interface{} {
+		return map[string]interface{}{"moe": moe, "larry": larry,
+			"curly": curly}
+	}
+	call("nestedStructTest", 12, map[string]interface{}{
+		"1999": map[string]interface{}{
+			"04": map[string]interface{}{"01": day(9, 9, 9)}},
+		"2000": map[string]interface{}{
+			"03": map[string]interface{}{"01": day(9, 9, 9)},
+			"04": map[string]interface{}{
+				"01": day(2, 4, 6), "02": day(9, 9, 9)}},
+	})
+
+	call("simpleStructReturnTest",
+		map[string]int{"times10": 70, "times100": 700, "times1000": 7000}, 7)
+}
@@ -0,0 +1,467 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the XML-RPC type of a Value
+type Kind int
+
+const (
+	Invalid  Kind = iota
+	Int           // <int>, <i4> or <i8>
+	Boolean       // <boolean>
+	String        // <string>, or text directly inside <value>
+	Double        // <double>
+	DateTime      // <dateTime.iso8601>
+	Base64        // <base64>
+	Struct        // <struct>
+	Array         // <array>
+	Nil           // <nil/>
+)
+
+var kindNames = []string{"invalid", "int", "boolean", "string", "double",
+	"dateTime.iso8601", "base64", "struct", "array", "nil"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// Value is a lossless tree of an XML-RPC <value>. Unlike the data given
+// by Unmarshal it keeps the element name used on the wire, the text of
+// scalars exactly as received and the order of struct members, so it can
+// be written back by Marshal without change.
+type Value struct {
+	Kind    Kind
+	Tag     string   // element name, "i4" or "int"..., "" for a raw text value
+	Text    string   // character data of a scalar, as received
+	Members []Member // members of a Struct, in document order
+	Items   []*Value // items of an Array
+}
+
+// Member is one member of a Struct Value
+type Member struct {
+	Name  string
+	Value *Value
+}
+
+// Message is a methodCall or methodResponse decoded as Values
+type Message struct {
+	MethodName string // empty for a methodResponse
+	Response   bool
+	Params     []*Value
+	Fault      *Value // the fault struct of a methodResponse, or nil
+}
+
+// builders, each one uses the canonical element name for its Kind
+
+func NewInt(i int) *Value {
+	return &Value{Kind: Int, Tag: "int", Text: strconv.Itoa(i)}
+}
+
+func NewBoolean(b bool) *Value {
+	v := &Value{Kind: Boolean, Tag: "boolean", Text: "0"}
+	if b {
+		v.Text = "1"
+	}
+	return v
+}
+
+func NewString(s string) *Value {
+	return &Value{Kind: String, Tag: "string", Text: s}
+}
+
+func NewDouble(f float64) *Value {
+	return &Value{Kind: Double, Tag: "double",
+		Text: strconv.FormatFloat(f, 'f', -1, 64)}
+}
+
+func NewDateTime(t time.Time) *Value {
+	return &Value{Kind: DateTime, Tag: "dateTime.iso8601",
+		Text: t.Format(ISO8601_LAYOUT)}
+}
+
+func NewBase64(b []byte) *Value {
+	return &Value{Kind: Base64, Tag: "base64",
+		Text: base64.StdEncoding.EncodeToString(b)}
+}
+
+func NewNil() *Value {
+	return &Value{Kind: Nil, Tag: "nil"}
+}
+
+func NewArray(items ...*Value) *Value {
+	return &Value{Kind: Array, Tag: "array", Items: items}
+}
+
+func NewStruct() *Value {
+	return &Value{Kind: Struct, Tag: "struct"}
+}
+
+// Set replaces the member called name of a Struct, or adds it at the
+// end, and returns v so calls can be chained
+func (v *Value) Set(name string, m *Value) *Value {
+	for i := range v.Members {
+		if v.Members[i].Name == name {
+			v.Members[i].Value = m
+			return v
+		}
+	}
+	v.Members = append(v.Members, Member{Name: name, Value: m})
+	return v
+}
+
+// Append adds items at the end of an Array and returns v
+func (v *Value) Append(items ...*Value) *Value {
+	v.Items = append(v.Items, items...)
+	return v
+}
+
+// accessors
+
+func (v *Value) kindError(k Kind) error {
+	if v == nil {
+		return fmt.Errorf("Missing %s value", k)
+	}
+	return fmt.Errorf("Value is %s, not %s", v.Kind, k)
+}
+
+// Int returns the value of an Int
+func (v *Value) Int() (int, error) {
+	if v == nil || v.Kind != Int {
+		return 0, v.kindError(Int)
+	}
+	return strconv.Atoi(strings.TrimSpace(v.Text))
+}
+
+// Bool returns the value of a Boolean
+func (v *Value) Bool() (bool, error) {
+	if v == nil || v.Kind != Boolean {
+		return false, v.kindError(Boolean)
+	}
+	switch strings.TrimSpace(v.Text) {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("Bad <boolean> value \"%s\"", v.Text)
+}
+
+// Str returns the text of a String
+func (v *Value) Str() (string, error) {
+	if v == nil || v.Kind != String {
+		return "", v.kindError(String)
+	}
+	return v.Text, nil
+}
+
+// Double returns the value of a Double
+func (v *Value) Double() (float64, error) {
+	if v == nil || v.Kind != Double {
+		return 0, v.kindError(Double)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(v.Text), 64)
+}
+
+// Time returns the value of a DateTime
+func (v *Value) Time() (time.Time, error) {
+	if v == nil || v.Kind != DateTime {
+		return time.Time{}, v.kindError(DateTime)
+	}
+	return time.Parse(ISO8601_LAYOUT, strings.TrimSpace(v.Text))
+}
+
+// Bytes returns the decoded data of a Base64
+func (v *Value) Bytes() ([]byte, error) {
+	if v == nil || v.Kind != Base64 {
+		return nil, v.kindError(Base64)
+	}
+	return decodeBase64(v.Text)
+}
+
+// Len returns the number of items of an Array or members of a Struct
+func (v *Value) Len() int {
+	if v == nil {
+		return 0
+	}
+	if v.Kind == Struct {
+		return len(v.Members)
+	}
+	return len(v.Items)
+}
+
+// Index returns item i of an Array, or nil
+func (v *Value) Index(i int) *Value {
+	if v == nil || v.Kind != Array || i < 0 || i >= len(v.Items) {
+		return nil
+	}
+	return v.Items[i]
+}
+
+// Member returns the member called name of a Struct, or nil. When the
+// name is repeated the last one wins, like Unmarshal does.
+func (v *Value) Member(name string) *Value {
+	if v == nil || v.Kind != Struct {
+		return nil
+	}
+	for i := len(v.Members) - 1; i >= 0; i-- {
+		if v.Members[i].Name == name {
+			return v.Members[i].Value
+		}
+	}
+	return nil
+}
+
+// Get follows a path of struct member names (string) and array indexes
+// (int) from v, as in v.Get("items", 3, "price"), and returns nil when
+// any step is missing
+func (v *Value) Get(path ...interface{}) *Value {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			v = v.Member(k)
+		case int:
+			v = v.Index(k)
+		default:
+			return nil
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// Interface converts v into the data Unmarshal gives for it
+func (v *Value) Interface() (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch v.Kind {
+	case Int:
+		return v.Int()
+	case Boolean:
+		return v.Bool()
+	case String:
+		return v.Text, nil
+	case Double:
+		return v.Double()
+	case DateTime:
+		return v.Time()
+	case Base64:
+		return v.Bytes()
+	case Nil:
+		return nil, nil
+	case Array:
+		arr := make([]interface{}, len(v.Items))
+		for i, item := range v.Items {
+			var err error
+			if arr[i], err = item.Interface(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case Struct:
+		m := make(map[string]interface{}, len(v.Members))
+		for _, mb := range v.Members {
+			var err error
+			if m[mb.Name], err = mb.Value.Interface(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("Cannot convert %s value", v.Kind)
+}
+
+// String returns the XML of v, for debugging
+func (v *Value) String() string {
+	buf := bytes.NewBufferString("")
+	if err := writeValue(buf, v); err != nil {
+		return fmt.Sprintf("<!-- %v -->", err)
+	}
+	return buf.String()
+}
+
+// SkipValue can be returned by a WalkFunc to skip the items or members
+// of the current value
+var SkipValue = errors.New("skip this value")
+
+// WalkFunc is called by Walk for every value, path holds the member
+// names (string) and array indexes (int) leading to it from the root
+type WalkFunc func(path []interface{}, v *Value) error
+
+// Walk calls fn for v and then for all its items or members, depth
+// first. It stops at the first error fn returns, other than SkipValue.
+func Walk(v *Value, fn WalkFunc) error {
+	err := walk(nil, v, fn)
+	if err == SkipValue {
+		err = nil
+	}
+	return err
+}
+
+func walk(path []interface{}, v *Value, fn WalkFunc) error {
+	if err := fn(path, v); err != nil {
+		if err == SkipValue {
+			return nil
+		}
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	n := len(path)
+	for i, item := range v.Items {
+		if err := walk(append(path[:n:n], i), item, fn); err != nil {
+			return err
+		}
+	}
+	for _, m := range v.Members {
+		if err := walk(append(path[:n:n], m.Name), m.Value, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write v back exactly as it was received, apart from white space
+func writeValue(w io.Writer, v *Value) error {
+	return newEncodeState(&defaultEncoder).writeValue(w, v, 0)
+}
+
+func (es *encodeState) writeValue(w io.Writer, v *Value, d int) error {
+	if v == nil {
+		fmt.Fprintf(w, "<nil/>")
+		return nil
+	}
+
+	// only a String can be written as raw text
+	tag := v.Tag
+	if tag == "" && (v.Kind != String || es.Format == FormatPretty) {
+		tag = v.Kind.String()
+	}
+	switch v.Kind {
+	case Struct:
+		members := v.Members
+		if es.sortMembers() {
+			members = append([]Member(nil), members...)
+			sort.SliceStable(members, func(i, j int) bool {
+				return members[i].Name < members[j].Name
+			})
+		}
+		fmt.Fprintf(w, "<%s>", tag)
+		es.nl(w)
+		for _, m := range members {
+			es.indent(w, d+1)
+			fmt.Fprintf(w, "<member>")
+			es.nl(w)
+			es.indent(w, d+2)
+			fmt.Fprintf(w, "<name>")
+			if err := es.escapeName(w, m.Name); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "</name>")
+			es.nl(w)
+			es.indent(w, d+2)
+			fmt.Fprintf(w, "<value>")
+			if err := es.writeValue(w, m.Value, d+2); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "</value>")
+			es.nl(w)
+			es.indent(w, d+1)
+			fmt.Fprintf(w, "</member>")
+			es.nl(w)
+		}
+		es.indent(w, d)
+		fmt.Fprintf(w, "</%s>", tag)
+	case Array:
+		fmt.Fprintf(w, "<%s>", tag)
+		es.indent(w, d+1)
+		fmt.Fprintf(w, "<data>")
+		es.nl(w)
+		for _, item := range v.Items {
+			es.indent(w, d+2)
+			fmt.Fprintf(w, "<value>")
+			if err := es.writeValue(w, item, d+2); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "</value>")
+			es.nl(w)
+		}
+		es.indent(w, d+1)
+		fmt.Fprintf(w, "</data>")
+		es.indent(w, d)
+		fmt.Fprintf(w, "</%s>", tag)
+	case Nil:
+		fmt.Fprintf(w, "<%s/>", tag)
+	case Int, Boolean, String, Double, DateTime, Base64:
+		if v.Kind == Double {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.Text), 64)
+			if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				return fmt.Errorf("Double %v cannot be written in XML-RPC", f)
+			}
+		}
+		if v.Kind == String && !es.representable(v.Text) {
+			if es.Invalid != InvalidBase64 {
+				return fmt.Errorf("String %q cannot be written in XML", v.Text)
+			}
+			fmt.Fprintf(w, "<base64>%s</base64>",
+				base64.StdEncoding.EncodeToString([]byte(v.Text)))
+			return nil
+		}
+		if tag != "" {
+			fmt.Fprintf(w, "<%s>", tag)
+		}
+		if err := xml.EscapeText(w, []byte(v.Text)); err != nil {
+			return err
+		}
+		if tag != "" {
+			fmt.Fprintf(w, "</%s>", tag)
+		}
+	default:
+		return fmt.Errorf("Cannot write %s value", v.Kind)
+	}
+	return nil
+}
+
+// MarshalMessage writes m as an XML-RPC document
+func MarshalMessage(w io.Writer, m *Message) error {
+	if m.Fault != nil {
+		fmt.Fprintf(w, "<?xml version=\"1.0\"?>\n<methodResponse>\n"+
+			"  <fault>\n	<value>")
+		if err := writeValue(w, m.Fault); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "</value>\n  </fault>\n</methodResponse>\n")
+		return nil
+	}
+
+	params := make([]interface{}, len(m.Params))
+	for i, p := range m.Params {
+		params[i] = p
+	}
+	name := m.MethodName
+	if !m.Response && name == "" {
+		return errors.New("A methodCall needs a method name")
+	}
+	if m.Response {
+		name = ""
+	}
+	return marshalArray(w, name, params)
+}
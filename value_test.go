@@ -0,0 +1,121 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const valueDoc = `<?xml version="1.0"?>
+<methodResponse>
+  <params>
+    <param><value><struct>
+      <member><name>id</name><value><i4>7</i4></value></member>
+      <member><name>count</name><value><int>7</int></value></member>
+      <member><name>raw</name><value> raw text </value></member>
+      <member><name>empty</name><value></value></member>
+      <member><name>none</name><value><nil/></value></member>
+      <member><name>items</name><value><array><data>
+        <value><struct>
+          <member><name>price</name><value><double>1.50</double></value></member>
+        </struct></value>
+        <value><string></string></value>
+      </data></array></value></member>
+    </struct></value></param>
+  </params>
+</methodResponse>`
+
+func TestUnmarshalValue(t *testing.T) {
+	m, err := UnmarshalValue(strings.NewReader(valueDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Response || len(m.Params) != 1 {
+		t.Fatalf("bad message %+v", m)
+	}
+	v := m.Params[0]
+
+	if id := v.Get("id"); id.Kind != Int || id.Tag != "i4" {
+		t.Errorf("id is %v", id)
+	}
+	if c := v.Get("count"); c.Kind != Int || c.Tag != "int" {
+		t.Errorf("count is %v", c)
+	}
+	if r := v.Get("raw"); r.Kind != String || r.Tag != "" || r.Text != " raw text " {
+		t.Errorf("raw is %#v", r)
+	}
+	if e := v.Get("empty"); e.Kind != String || e.Tag != "" || e.Text != "" {
+		t.Errorf("empty is %#v", e)
+	}
+	if n := v.Get("none"); n.Kind != Nil {
+		t.Errorf("none is %v", n)
+	}
+	if s := v.Get("items", 1); s.Kind != String || s.Tag != "string" {
+		t.Errorf("items[1] is %#v", s)
+	}
+	price, err := v.Get("items", 0, "price").Double()
+	if err != nil || price != 1.5 {
+		t.Errorf("price is %v, %v", price, err)
+	}
+	if v.Get("items", 5, "price") != nil || v.Get("id", "x") != nil {
+		t.Errorf("missing path did not give nil")
+	}
+	if _, err = v.Get("raw").Int(); err == nil {
+		t.Errorf("Int of a string did not fail")
+	}
+
+	var paths []string
+	Walk(v, func(path []interface{}, v *Value) error {
+		if v.Kind == Array {
+			return SkipValue
+		}
+		if v.Kind != Struct {
+			paths = append(paths, fmt.Sprint(path...))
+		}
+		return nil
+	})
+	if strings.Join(paths, ",") != "id,count,raw,empty,none" {
+		t.Errorf("Walk visited %v", paths)
+	}
+
+	// writing the tree back and decoding it again gives the same tree
+	buf := bytes.NewBufferString("")
+	if err = MarshalMessage(buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := UnmarshalValue(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Errorf("round trip changed the message:\n%s", v)
+	}
+
+	i, err := v.Interface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, err, _ := UnmarshalString(valueDoc)
+	if err != nil || !reflect.DeepEqual(i, p.([]interface{})[0]) {
+		t.Errorf("Interface gave %v, Unmarshal %v", i, p)
+	}
+}
+
+func TestMarshalValue(t *testing.T) {
+	v := NewStruct().Set("a", NewInt(1)).Set("b",
+		NewArray(NewString("x<y"), NewBoolean(true), NewNil()))
+	buf := bytes.NewBufferString("")
+	if err := Marshal(buf, "m", v, &Value{Kind: String, Text: " raw "}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := UnmarshalValue(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MethodName != "m" || len(m.Params) != 2 ||
+		!reflect.DeepEqual(m.Params[0], v) || m.Params[1].Text != " raw " {
+		t.Errorf("bad message %v", m.Params)
+	}
+}
@@ -1,18 +1,24 @@
 package xmlrpc
 
 import (
+    "context"
+    "encoding"
     "io"
 //    "os"  
     "fmt"
     "time"
     "bytes"
     "errors"
+    "math"
     "reflect"
     "strconv"
+    "sort"
     "strings"
+    "sync"
     "net/url"
     "net/http"
     "encoding/xml"
+    "encoding/base64"
 )
 
 
@@ -28,12 +34,29 @@ type DICT map[string]interface{}
 type Fault struct {
 	Code int
 	Msg  string
+	// behind a pointer, which keeps Faults comparable
+	extra *faultExtra
+}
+
+type faultExtra struct {
+	members map[string]interface{}
+	limited bool // rejected by a Limiter, not by the method
 }
 
 func NewFault(code int, msg string) *Fault {
 	return &Fault{Code: code, Msg: msg}
 }
 
+// Extra returns the members of the fault struct other than faultCode and
+// faultString, such as a stack trace or an error ID, nil when there are
+// none
+func (f *Fault) Extra() map[string]interface{} {
+	if f == nil || f.extra == nil {
+		return nil
+	}
+	return f.extra.members
+}
+
 // Return a string representation of the XML-RPC fault
 func (f *Fault) String() string {
 	if f == nil {
@@ -42,6 +65,11 @@ func (f *Fault) String() string {
 	return fmt.Sprintf("%s (code#%d)", f.Msg, f.Code)
 }
 
+// Error lets a *Fault be returned where an error is expected
+func (f *Fault) Error() string {
+	return f.String()
+}
+
 func extractParams(v []interface{}) interface{} {
 	if len(v) == 0 {
 		return nil
@@ -131,17 +159,19 @@ func getMethodData(p *xml.Decoder) ([]interface{}, *Fault, error) {
 		} else if inParams {
 			if tok.Is(tokenParam) {
 				inParam = tok.IsStart()
-			//	continue
-			//} else if inParam {
-                if ! inParam { continue }
-				p, perr := getValue(p)
+				//	continue
+				//} else if inParam {
+				if !inParam {
+					continue
+				}
+				p, perr := getValue(p, 0)
 				if perr != nil {
 					return nil, nil, perr
 				}
 
 				params = append(params, p)
 				inParam = false
-                continue
+				continue
 			}
 		}
 
@@ -155,12 +185,20 @@ func getMethodData(p *xml.Decoder) ([]interface{}, *Fault, error) {
 			continue
 		} else if inFault {
 			var ferr error
-			fault, ferr = getFault(p)
+			if tok.Is(tokenValue) && tok.IsStart() {
+				// <fault><value> with no white space between them
+				var val interface{}
+				val, ferr = getValueRest(p, 0)
+				fault = faultFromData(val)
+			} else {
+				fault, ferr = getFault(p)
+			}
 			if ferr != nil {
 				return nil, nil, ferr
 			}
 
 			inFault = false
+			continue
 		}
 
 		if !tok.IsText() {
@@ -174,19 +212,80 @@ func getMethodData(p *xml.Decoder) ([]interface{}, *Fault, error) {
 
 // get the XML-RPC fault
 func getFault(p *xml.Decoder) (*Fault, error) {
-	val, err := getValue(p)
+	val, err := getValue(p, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	fmap := val.(map[string]interface{})
+	return faultFromData(val), nil
+}
+
+// build a Fault from the decoded <fault> value. Servers do not all follow
+// the spec: faultCode may be a string or a double, and the value may not
+// be a struct at all, in which case it becomes the message.
+func faultFromData(val interface{}) *Fault {
+	fmap, ok := val.(map[string]interface{})
+	if !ok {
+		if val == nil {
+			return &Fault{}
+		} else if s, ok := val.(string); ok {
+			return &Fault{Msg: s}
+		} else if b, ok := val.([]byte); ok {
+			return &Fault{Msg: string(b)}
+		}
+		return &Fault{Msg: fmt.Sprint(val)}
+	}
+
+	f := &Fault{}
+	var extra map[string]interface{}
+	for k, v := range fmap {
+		switch k {
+		case "faultCode":
+			if code, ok := faultCode(v); ok {
+				f.Code = code
+				continue
+			}
+		case "faultString":
+			if s, ok := v.(string); ok {
+				f.Msg = s
+			} else if b, ok := v.([]byte); ok {
+				// sent as <base64> since it could not be written as text
+				f.Msg = string(b)
+			} else if v != nil {
+				f.Msg = fmt.Sprint(v)
+			}
+			continue
+		}
+		// unknown members, and a faultCode which is not a number
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[k] = v
+	}
+	if extra != nil {
+		f.extra = &faultExtra{members: extra}
+	}
+	return f
+}
 
-	return &Fault{Code: fmap["faultCode"].(int),
-		Msg: fmap["faultString"].(string)}, nil
+func faultCode(v interface{}) (int, bool) {
+	switch c := v.(type) {
+	case int:
+		return c, true
+	case float64:
+		if c == math.Trunc(c) && math.Abs(c) <= math.MaxInt32 {
+			return int(c), true
+		}
+	case string:
+		if i, err := strconv.Atoi(strings.TrimSpace(c)); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
 }
 
-// parse a <value>
-func getValue(p *xml.Decoder) (interface{}, error) {
+// parse a <value>, nested in depth arrays and structs
+func getValue(p *xml.Decoder, depth int) (interface{}, error) {
 	var value interface{}
 
 	for {
@@ -204,7 +303,7 @@ func getValue(p *xml.Decoder) (interface{}, error) {
 			}
 
 			var sawEndValue bool
-			value, sawEndValue, err = getValueData(p)
+			value, sawEndValue, err = getValueData(p, depth)
 			if err != nil {
 				return nil, err
 			} else if sawEndValue {
@@ -227,8 +326,36 @@ func getValue(p *xml.Decoder) (interface{}, error) {
 	return value, nil
 }
 
+// parse what follows the start of a <value>, up to its end
+func getValueRest(p *xml.Decoder, depth int) (interface{}, error) {
+	value, sawEndValue, err := getValueData(p, depth)
+	if err != nil {
+		return nil, err
+	} else if sawEndValue {
+		if value == nil {
+			value = ""
+		}
+		return value, nil
+	}
+
+	for {
+		tok, err := getNextToken(p)
+		if tok == nil {
+			return nil, errors.New("Unexpected end-of-file in getValue()")
+		} else if err != nil {
+			return nil, err
+		}
+
+		if tok.Is(tokenValue) && !tok.IsStart() {
+			return value, nil
+		} else if !tok.IsText() {
+			return nil, fmt.Errorf("Unexpected value token %v", tok)
+		}
+	}
+}
+
 // parse the <value> data
-func getValueData(p *xml.Decoder) (interface{}, bool, error) {
+func getValueData(p *xml.Decoder, depth int) (interface{}, bool, error) {
 	var toktype = tokenUnknown
 	var value interface{}
 	for {
@@ -244,7 +371,7 @@ func getValueData(p *xml.Decoder) (interface{}, bool, error) {
 			if tok.IsStart() {
 				if toktype == tokenUnknown {
 					toktype = tok.token
-					value, err = getData(p, tok)
+					value, err = getData(p, tok, depth)
 					if err != nil {
 						return nil, false, err
 					}
@@ -277,7 +404,7 @@ func getValueData(p *xml.Decoder) (interface{}, bool, error) {
 }
 
 // parse a <struct>
-func getStruct(p *xml.Decoder) (map[string]interface{}, error) {
+func getStruct(p *xml.Decoder, depth int) (map[string]interface{}, error) {
 	var data = make(map[string]interface{})
 
 	// state variables
@@ -317,7 +444,7 @@ func getStruct(p *xml.Decoder) (map[string]interface{}, error) {
 					}
 
 					if gotName && !inName {
-						value, verr := getValue(p)
+						value, verr := getValue(p, depth+1)
 						if verr != nil {
 							return nil, verr
 						}
@@ -343,7 +470,7 @@ func getStruct(p *xml.Decoder) (map[string]interface{}, error) {
 }
 
 // parse an <array>
-func getArray(p *xml.Decoder) (interface{}, error) {
+func getArray(p *xml.Decoder, depth int) (interface{}, error) {
 	var data = make([]interface{}, 0)
 
 	// state variables
@@ -373,7 +500,7 @@ func getArray(p *xml.Decoder) (interface{}, error) {
 			} else if inData {
 				if tok.Is(tokenValue) {
 					if tok.IsStart() {
-						value, sawEndValue, verr := getValueData(p)
+						value, sawEndValue, verr := getValueData(p, depth+1)
 						if verr != nil {
 							return nil, verr
 						} else if sawEndValue {
@@ -396,22 +523,22 @@ func getArray(p *xml.Decoder) (interface{}, error) {
 		}
 	}
 
-/*
-	if data == nil {
-		return nil, nil
-	}
+	/*
+	   	if data == nil {
+	   		return nil, nil
+	   	}
 
-	var array = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(data[0])),
-		len(data), len(data))
-	for i := 0; i < len(data); i++ {
-		v := reflect.ValueOf(data[i])
-fmt.Printf("#%d append %v<%T> to %v<%T>\n", i, v, v, array, array)
-		//array = appendValue(array, data[i])
-		array = reflect.Append(array, v)
-	}
+	   	var array = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(data[0])),
+	   		len(data), len(data))
+	   	for i := 0; i < len(data); i++ {
+	   		v := reflect.ValueOf(data[i])
+	   fmt.Printf("#%d append %v<%T> to %v<%T>\n", i, v, v, array, array)
+	   		//array = appendValue(array, data[i])
+	   		array = reflect.Append(array, v)
+	   	}
 
-	return array.Slice(0, array.Len()), nil
-*/
+	   	return array.Slice(0, array.Len()), nil
+	*/
 
 	return data, nil
 }
@@ -425,7 +552,8 @@ func getText(p *xml.Decoder) (string, error) {
 		return "", err
 	}
 
-	if tok.Is(tokenString) && !tok.IsStart() {
+	if (tok.Is(tokenString) || tok.Is(tokenBase64)) && !tok.IsStart() {
+		// empty <string></string> or <base64></base64>
 		return "", nil
 	} else if !tok.IsText() {
 		return "", fmt.Errorf("Unexpected token %s in getText()", tok)
@@ -445,16 +573,52 @@ func getDateISO8601(p *xml.Decoder) (interface{}, error) {
 	return time.Parse(ISO8601_LAYOUT, valStr)
 }
 
+// parse a <base64>
+func getBase64(p *xml.Decoder) (interface{}, error) {
+	valStr, err := getText(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeBase64(valStr)
+}
+
+// decode base64 text, some servers leave out the padding or break the
+// text into lines
+func decodeBase64(valStr string) ([]byte, error) {
+	valStr = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, valStr)
+	enc := base64.StdEncoding
+	if len(valStr)%4 != 0 {
+		enc = base64.RawStdEncoding
+	}
+	return enc.DecodeString(valStr)
+}
+
+// arrays and structs nested deeper than this are rejected, so that a
+// hostile document cannot exhaust the stack
+const maxDepth = 1000
+
 // convert the XML-RPC to Go data
-func getData(p *xml.Decoder, tok *xmlToken) (interface{}, error) {
+func getData(p *xml.Decoder, tok *xmlToken, depth int) (interface{}, error) {
 	var valStr string
 	var err error
 
+	if (tok.token == tokenArray || tok.token == tokenStruct) &&
+		depth >= maxDepth {
+		return nil, fmt.Errorf("Values nested deeper than %d in getData()",
+			maxDepth)
+	}
+
 	switch tok.token {
 	case tokenArray:
-		return getArray(p)
+		return getArray(p, depth)
 	case tokenBase64:
-		return nil, errors.New("parseDataString(base64) unimplemented")
+		return getBase64(p)
 	case tokenBoolean:
 		valStr, err = getText(p)
 		if err != nil {
@@ -499,14 +663,14 @@ func getData(p *xml.Decoder, tok *xmlToken) (interface{}, error) {
 		return nil, nil
 	case tokenString:
 		valStr, err = getText(p)
-        //fmt.Fprintf(os.Stderr, "valStr = [%v]", valStr)
+		//fmt.Fprintf(os.Stderr, "valStr = [%v]", valStr)
 		if err != nil {
 			return nil, err
 		}
 
 		return valStr, nil
 	case tokenStruct:
-		return getStruct(p)
+		return getStruct(p, depth)
 	default:
 		break
 	}
@@ -516,10 +680,11 @@ func getData(p *xml.Decoder, tok *xmlToken) (interface{}, error) {
 
 // Translate an XML stream into a local data object
 func Unmarshal(r io.Reader) (string, interface{}, error, *Fault) {
-    if r == nil {
-        return "", nil, fmt.Errorf("reader is nil"), nil
-    }
+	if r == nil {
+		return "", nil, fmt.Errorf("reader is nil"), nil
+	}
 	p := xml.NewDecoder(r)
+	p.CharsetReader = CharsetReader
 
 	var methodName string
 	var params []interface{}
@@ -529,6 +694,10 @@ func Unmarshal(r io.Reader) (string, interface{}, error, *Fault) {
 	for {
 		tok, err := getNextToken(p)
 		if tok == nil {
+			if err != nil && err != io.EOF {
+				// such as an unsupported charset
+				return "", nil, err, nil
+			}
 			break
 		} else if err != nil {
 			return "", nil, err, nil
@@ -567,7 +736,7 @@ func Unmarshal(r io.Reader) (string, interface{}, error, *Fault) {
 			return "", nil, perr, nil
 		}
 	}
-  //fmt.Fprintf(os.Stderr, "params = %v\n", params)
+	//fmt.Fprintf(os.Stderr, "params = %v\n", params)
 	//return methodName, extractParams(params), nil, fault
 	return methodName, params, nil, fault
 }
@@ -578,112 +747,290 @@ func UnmarshalString(s string) (string, interface{}, error, *Fault) {
 }
 
 // translate an array into XML
-func wrapArray(w io.Writer, val reflect.Value) error {
-	fmt.Fprintf(w, "<array><data>\n")
+func (es *encodeState) wrapArray(w io.Writer, val reflect.Value, d int) error {
+	fmt.Fprintf(w, "<array>")
+	es.indent(w, d+1)
+	fmt.Fprintf(w, "<data>")
+	es.nl(w)
 
 	for i := 0; i < val.Len(); i++ {
+		es.indent(w, d+2)
 		fmt.Fprintf(w, "<value>")
-		aerr := wrapValue(w, val.Index(i))
+		aerr := es.wrapValue(w, val.Index(i), d+2)
 		if aerr != nil {
 			return aerr
 		}
-		fmt.Fprintf(w, "</value>\n")
+		fmt.Fprintf(w, "</value>")
+		es.nl(w)
 	}
 
-	fmt.Fprintf(w, "</data></array>")
+	es.indent(w, d+1)
+	fmt.Fprintf(w, "</data>")
+	es.indent(w, d)
+	fmt.Fprintf(w, "</array>")
 	return nil
 }
 
-// translate an map[string]interface{} into XML
-func wrapMap(w io.Writer, val reflect.Value) error {
-    ks := val.MapKeys()
-    if len(ks) < 1 {
-        //return fmt.Errorf("Empty Map")
-        fmt.Fprintf(w, "<struct>\n</struct>")
-        return nil
-    }
-    if ks[0].Kind() != reflect.String {
-        return fmt.Errorf("Only support map[string]interface{}, got %v", val)
-    }
-    fmt.Fprintf(w, "<struct>\n")
-    for _, k := range ks {
-        fmt.Fprintf(w, "<member>\n")
-        fmt.Fprintf(w, "<name>%s</name>\n", k)
-        fmt.Fprintf(w, "<value>")
-        ret := wrapValue(w, val.MapIndex(k))
-        if ret != nil { return ret }
-        fmt.Fprintf(w, "</value>\n</member>\n")
-    }
-    fmt.Fprintf(w, "</struct>")
-    return nil
-    //return fmt.Errorf("Not wrapping type %v (%v)", val.Kind().String(), val)
+// write one <member> of a <struct>
+func (es *encodeState) wrapMember(w io.Writer, name string, val reflect.Value, d int) error {
+	es.indent(w, d+1)
+	fmt.Fprintf(w, "<member>")
+	es.nl(w)
+	es.indent(w, d+2)
+	fmt.Fprintf(w, "<name>")
+	if err := es.escapeName(w, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "</name>")
+	es.nl(w)
+	es.indent(w, d+2)
+	fmt.Fprintf(w, "<value>")
+	ret := es.wrapValue(w, val, d+2)
+	if ret != nil {
+		return ret
+	}
+	fmt.Fprintf(w, "</value>")
+	es.nl(w)
+	es.indent(w, d+1)
+	fmt.Fprintf(w, "</member>")
+	es.nl(w)
+	return nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// the member name for a map key, turned into a string the way
+// encoding/json does it
+func mapKeyName(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if k.Type().Implements(textMarshalerType) {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("Unsupported map key type %v", k.Type())
+}
+
+// translate a map into an XML <struct>
+func (es *encodeState) wrapMap(w io.Writer, val reflect.Value, d int) error {
+	ks := val.MapKeys()
+	names := make([]string, len(ks))
+	for i, k := range ks {
+		var err error
+		if names[i], err = mapKeyName(k); err != nil {
+			return err
+		}
+	}
+	if es.sortMembers() {
+		sort.Sort(&mapKeys{names, ks})
+	}
+	fmt.Fprintf(w, "<struct>")
+	es.nl(w)
+	for i, k := range ks {
+		if es.omit(val.MapIndex(k)) {
+			continue
+		}
+		ret := es.wrapMember(w, names[i], val.MapIndex(k), d)
+		if ret != nil {
+			return ret
+		}
+	}
+	es.indent(w, d)
+	fmt.Fprintf(w, "</struct>")
+	return nil
+}
+
+// sorts map keys by their member names
+type mapKeys struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (m *mapKeys) Len() int { return len(m.names) }
+func (m *mapKeys) Less(i, j int) bool { return m.names[i] < m.names[j] }
+func (m *mapKeys) Swap(i, j int) {
+	m.names[i], m.names[j] = m.names[j], m.names[i]
+	m.keys[i], m.keys[j] = m.keys[j], m.keys[i]
 }
 
 
 // translate an map[string]interface{} into XML
-func wrapStruct(w io.Writer, val reflect.Value) error {
-    fmt.Fprintf(w, "<struct>\n")
-    for i := 0; i < val.NumField(); i++ {
-        f := val.Type().Field(i)
-        fmt.Fprintf(w, "<member>\n")
-        fmt.Fprintf(w, "<name>%s</name>\n", f.Name)
-        fmt.Fprintf(w, "<value>")
-        ret := wrapValue(w, val.Field(i))
-        if ret != nil { return ret }
-        fmt.Fprintf(w, "</value>\n</member>\n")
-    }
-    fmt.Fprintf(w, "</struct>")
-    return nil
+func (es *encodeState) wrapStruct(w io.Writer, val reflect.Value, d int) error {
+	fields := make([]int, val.NumField())
+	for i := range fields {
+		fields[i] = i
+	}
+	if es.sortMembers() {
+		sort.Slice(fields, func(i, j int) bool {
+			return val.Type().Field(fields[i]).Name < val.Type().Field(fields[j]).Name
+		})
+	}
+	fmt.Fprintf(w, "<struct>")
+	es.nl(w)
+	for _, i := range fields {
+		f := val.Type().Field(i)
+		if es.omit(val.Field(i)) {
+			continue
+		}
+		ret := es.wrapMember(w, f.Name, val.Field(i), d)
+		if ret != nil {
+			return ret
+		}
+	}
+	es.indent(w, d)
+	fmt.Fprintf(w, "</struct>")
+	return nil
 }
 
 
 // translate a parameter into XML
-func wrapParam(w io.Writer, i int, xval interface{}) error {
-	var valStr string
+func (es *encodeState) wrapParam(w io.Writer, i int, xval interface{}) error {
+	if es.Format != FormatDefault {
+		es.indent(w, 2)
+		fmt.Fprintf(w, "<param>")
+		es.indent(w, 3)
+		fmt.Fprintf(w, "<value>")
+		if err := es.wrapValue(w, reflect.ValueOf(xval), 3); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "</value>")
+		es.indent(w, 2)
+		fmt.Fprintf(w, "</param>")
+		return nil
+	}
 
-	fmt.Fprintf(w, "	<param>\n	  <value>\n		")
-	if xval == nil {
-		valStr = "<nil/>"
-	} else {
-		err := wrapValue(w, reflect.ValueOf(xval))
-		if err != nil {
+	if v, ok := xval.(*Value); ok && v != nil && v.Tag == "" && v.Kind == String {
+		// white space around a raw text value would become part of it
+		fmt.Fprintf(w, "	<param>\n	  <value>")
+		if err := es.writeValue(w, v, 0); err != nil {
 			return err
 		}
+		fmt.Fprintf(w, "</value>\n	</param>\n")
+		return nil
+	}
+
+	fmt.Fprintf(w, "	<param>\n	  <value>\n		")
+	err := es.wrapValue(w, reflect.ValueOf(xval), 0)
+	if err != nil {
+		return err
 	}
-	fmt.Fprintf(w, "%s\n	  </value>\n	</param>\n", valStr)
+	fmt.Fprintf(w, "\n	  </value>\n	</param>\n")
 
 	return nil
 }
 
 // cached time.Time reflect.Type value
-var timeType reflect.Type
+var timeType = reflect.TypeOf(time.Time{})
+
+var valueType = reflect.TypeOf(Value{})
+var valuePtrType = reflect.TypeOf((*Value)(nil))
+
+// write a nil pointer, map, slice or interface as the nil policy says
+func (es *encodeState) wrapNil(w io.Writer, val reflect.Value, d int) error {
+	if es.Nil != NilEmpty {
+		fmt.Fprintf(w, "<nil/>")
+		return nil
+	}
+
+	if !val.IsValid() || val.Kind() == reflect.Interface {
+		// no type to take the empty value of
+		fmt.Fprintf(w, "<string></string>")
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Map:
+		return es.wrapMap(w, reflect.MakeMap(val.Type()), d)
+	case reflect.Slice:
+		return es.wrapValue(w, reflect.MakeSlice(val.Type(), 0, 0), d)
+	}
+
+	// a pointer, stop at the first struct since it may point back to its
+	// own type
+	elem := val.Type().Elem()
+	if elem.Kind() == reflect.Struct && elem != timeType && elem != valueType {
+		fmt.Fprintf(w, "<struct>")
+		es.nl(w)
+		es.indent(w, d)
+		fmt.Fprintf(w, "</struct>")
+		return nil
+	}
+	return es.wrapValue(w, reflect.Zero(elem), d)
+}
 
 // translate Go data into XML
 func wrapValue(w io.Writer, val reflect.Value) error {
+	return newEncodeState(&defaultEncoder).wrapValue(w, val, 0)
+}
+
+// translate Go data into XML, d is the depth of the enclosing <value>
+func (es *encodeState) wrapValue(w io.Writer, val reflect.Value, d int) error {
 	var isError = false
 
+	if !val.IsValid() {
+		// a nil interface{}
+		return es.wrapNil(w, val, d)
+	}
+	switch val.Type() {
+	case valuePtrType:
+		return es.writeValue(w, val.Interface().(*Value), d)
+	case valueType:
+		v := val.Interface().(Value)
+		return es.writeValue(w, &v, d)
+	}
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if val.IsNil() {
+			return es.wrapNil(w, val, d)
+		}
+	}
+
 	switch val.Kind() {
 	case reflect.Bool:
-		 bval := 0
+		bval := 0
 		if val.Bool() {
 			bval = 1
 		}
 		fmt.Fprintf(w, "<boolean>%d</boolean>", bval)
 	case reflect.Float32, reflect.Float64:
-		fmt.Fprintf(w, "<double>%f</double>", val.Float())
+		f := val.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("Double %v cannot be written in XML-RPC", f)
+		}
+		// shortest form that reads back the same value, without exponent
+		fmt.Fprintf(w, "<double>%s</double>",
+			strconv.FormatFloat(f, 'f', -1, val.Type().Bits()))
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		fmt.Fprintf(w, "<int>%d</int>", val.Int())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		fmt.Fprintf(w, "<int>%d</int>", val.Uint())
 	case reflect.String:
-        //fmt.Fprintf(w, "<string>%s</string>", val.String())
-        fmt.Fprintf(w, "<string>")
-        err := xml.EscapeText(w, []byte(val.String()))
-        if err != nil {
-            return fmt.Errorf("Failed to wrapping type %v (%v), err=%s",
-                              val.Kind().String(), val, err.Error())
-        }
-        fmt.Fprintf(w, "</string>")
+		if !es.representable(val.String()) {
+			if es.Invalid == InvalidBase64 {
+				fmt.Fprintf(w, "<base64>%s</base64>",
+					base64.StdEncoding.EncodeToString([]byte(val.String())))
+				return nil
+			}
+			return fmt.Errorf("String %q cannot be written in XML", val.String())
+		}
+		//fmt.Fprintf(w, "<string>%s</string>", val.String())
+		fmt.Fprintf(w, "<string>")
+		err := xml.EscapeText(w, []byte(val.String()))
+		if err != nil {
+			return fmt.Errorf("Failed to wrapping type %v (%v), err=%s",
+				val.Kind().String(), val, err.Error())
+		}
+		fmt.Fprintf(w, "</string>")
 	//case reflect.Uint:
 	//	isError = true
 	//case reflect.Uint8:
@@ -701,29 +1048,42 @@ func wrapValue(w io.Writer, val reflect.Value) error {
 	case reflect.Complex128:
 		isError = true
 	case reflect.Array:
-		return wrapArray(w, val)
+		return es.wrapArray(w, val, d)
 	case reflect.Chan:
 		isError = true
 	case reflect.Func:
 		isError = true
 	case reflect.Interface:
 		//isError = true
-        return wrapValue(w, val.Elem())
+		return es.wrapValue(w, val.Elem(), d)
 	case reflect.Map:
 		//isError = true
-		return wrapMap(w, val)
+		if err := es.enter(val); err != nil {
+			return err
+		}
+		defer es.leave(val)
+		return es.wrapMap(w, val, d)
 	case reflect.Ptr:
-		isError = true
+		if err := es.enter(val); err != nil {
+			return err
+		}
+		defer es.leave(val)
+		return es.wrapValue(w, val.Elem(), d)
 	case reflect.Slice:
-		return wrapArray(w, val)
-	case reflect.Struct:
-		if timeType == nil {
-			timeType = reflect.TypeOf((*time.Time)(nil)).Elem()
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(w, "<base64>%s</base64>",
+				base64.StdEncoding.EncodeToString(val.Bytes()))
+			return nil
 		}
-
+		if err := es.enter(val); err != nil {
+			return err
+		}
+		defer es.leave(val)
+		return es.wrapArray(w, val, d)
+	case reflect.Struct:
 		if !val.Type().ConvertibleTo(timeType) {
 			//isError = true
-            return wrapStruct(w, val)
+			return es.wrapStruct(w, val, d)
 		} else {
 			method := val.MethodByName("Format")
 			params := []reflect.Value{reflect.ValueOf(ISO8601_LAYOUT)}
@@ -752,6 +1112,14 @@ func Marshal(w io.Writer, methodName string, args ...interface{}) error {
 
 // Write an array of zero or more data objects as an XML-RPC request
 func marshalArray(w io.Writer, methodName string, args []interface{}) error {
+	return defaultEncoder.marshalArray(w, methodName, args)
+}
+
+// Write an array of zero or more data objects as an XML-RPC request
+func (e *Encoder) marshalArray(w io.Writer, methodName string, args []interface{}) error {
+	if e == nil {
+		e = &defaultEncoder
+	}
 	var name string
 	var addExtra bool
 	if methodName == "" {
@@ -762,22 +1130,63 @@ func marshalArray(w io.Writer, methodName string, args []interface{}) error {
 		addExtra = true
 	}
 
-	fmt.Fprintf(w, "<?xml version=\"1.0\"?>\n<method%s>\n", name)
+	es := newEncodeState(e)
+	cw, ok := e.charsetWriter(w)
+	if isUTF8(e.Charset) {
+		fmt.Fprintf(w, "<?xml version=\"1.0\"?>")
+	} else {
+		if !ok {
+			return fmt.Errorf("Unsupported charset %q", e.Charset)
+		}
+		w = cw
+		fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"%s\"?>", e.Charset)
+	}
+	es.nl(w)
+	es.indent(w, 0)
+	fmt.Fprintf(w, "<method%s>", name)
+	es.nl(w)
 	if addExtra {
-		fmt.Fprintf(w, "  <methodName>%s</methodName>\n", methodName)
+		if e.Format == FormatDefault {
+			fmt.Fprintf(w, "  ")
+		}
+		es.indent(w, 1)
+		fmt.Fprintf(w, "<methodName>")
+		if err := es.escapeName(w, methodName); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "</methodName>")
+		es.nl(w)
 	}
 
-	fmt.Fprintf(w, "  <params>\n")
+	if e.Format == FormatDefault {
+		fmt.Fprintf(w, "  ")
+	}
+	es.indent(w, 1)
+	fmt.Fprintf(w, "<params>")
+	es.nl(w)
 
 	for i, a := range args {
-		err := wrapParam(w, i, a)
+		err := es.wrapParam(w, i, a)
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Fprintf(w, "  </params>\n</method%s>\n", name)
+	if e.Format == FormatDefault {
+		fmt.Fprintf(w, "  ")
+	}
+	es.indent(w, 1)
+	fmt.Fprintf(w, "</params>")
+	es.nl(w)
+	es.indent(w, 0)
+	fmt.Fprintf(w, "</method%s>", name)
+	if e.Format != FormatCanonical {
+		fmt.Fprintf(w, "\n")
+	}
 
+	if ok {
+		return cw.Flush()
+	}
 	return nil
 }
 
@@ -786,10 +1195,21 @@ func marshalArray(w io.Writer, methodName string, args []interface{}) error {
 type Client struct {
 	http.Client
 	urlStr string
+
+	mu      sync.Mutex
+	sem     chan struct{} // limits in-flight calls made by Go, nil means no limit
+	enc     *Encoder
+	strict  bool // decode responses with a strict Decoder
+	metrics Metrics
+	tracer  Tracer
 }
 
 
 // connect to a remote XML-RPC server
+//
+// An "scgi://host:port/path" address calls the server over SCGI instead
+// of HTTP, and a "unix:///path/to/socket" address makes HTTP calls to
+// /RPC2 over the Unix domain socket, which is what supervisord expects
 //func NewClient(host string, port int) (*Client, error) {
 //    address := fmt.Sprintf("http://%s:%d/RPC2", host, port)
 func NewClient(address string) (*Client, error) {
@@ -797,27 +1217,89 @@ func NewClient(address string) (*Client, error) {
 	if uerr != nil {
 		return nil, uerr
 	}
-	return &Client{urlStr: uurl.String()}, nil
+	c := &Client{}
+	switch uurl.Scheme {
+	case "scgi":
+		c.Transport = NewSCGITransport("tcp", uurl.Host)
+		uurl.Scheme = "http"
+	case "unix":
+		if uurl.Path == "" {
+			return nil, fmt.Errorf("No socket path in %q", address)
+		}
+		c.Transport = unixTransport(uurl.Path)
+		uurl = &url.URL{Scheme: "http", Host: "unix", Path: "/RPC2"}
+	}
+	c.urlStr = uurl.String()
+	return c, nil
 }
 
 
 // call a procedure on a remote XML-RPC server
 func (c *Client) RPCCall(methodName string,
 	args ...interface{}) (interface{}, error, *Fault) {
+	return c.RPCCallContext(context.Background(), methodName, args...)
+}
+
+// call a procedure on a remote XML-RPC server, ctx cancels the call and
+// its span context is sent in the traceparent and tracestate headers
+func (c *Client) RPCCallContext(ctx context.Context, methodName string,
+	args ...interface{}) (interface{}, error, *Fault) {
+	var st callStats
+	if c.metrics == nil && c.tracer == nil {
+		return c.post(ctx, methodName, args, &st)
+	}
+
+	var span Span
+	if c.tracer != nil {
+		ctx, span = c.tracer.StartSpan(ctx, SpanClient, methodName)
+	}
+	if c.metrics != nil {
+		c.metrics.InFlight(1)
+	}
+	start := time.Now()
+	result, err, fault := c.post(ctx, methodName, args, &st)
+	code := 0
+	if fault != nil {
+		code = fault.Code
+	}
+
+	if c.metrics != nil {
+		c.metrics.InFlight(-1)
+		c.metrics.Observe(Observation{Method: methodName, Code: code,
+			Duration: time.Since(start), RequestSize: st.reqSize,
+			ResponseSize: st.respSize, Err: err != nil})
+	}
+	if span != nil {
+		span.End(SpanEnd{Method: methodName, Code: code, Err: err,
+			RequestSize: st.reqSize, ResponseSize: st.respSize})
+	}
+	return result, err, fault
+}
+
+// sizes of the documents of a call
+type callStats struct {
+	reqSize  int64
+	respSize int64
+}
 
+// send a call and decode the answer
+func (c *Client) post(ctx context.Context, methodName string, args []interface{},
+	st *callStats) (interface{}, error, *Fault) {
 	buf := bytes.NewBufferString("")
-	berr := marshalArray(buf, methodName, args)
+	berr := c.enc.marshalArray(buf, methodName, args)
 	if berr != nil {
 		return nil, berr, nil
 	}
+	st.reqSize = int64(buf.Len())
 
-	req, err := http.NewRequest("POST", c.urlStr,
+	req, err := http.NewRequestWithContext(ctx, "POST", c.urlStr,
 		strings.NewReader(buf.String()))
 	if err != nil {
 		return nil, err, nil
 	}
 
-	req.Header.Add("Content-Type", "text/xml")
+	req.Header.Add("Content-Type", c.enc.contentType())
+	injectTrace(ctx, req.Header)
 
 	r, err := c.Do(req)
 	if err != nil {
@@ -828,11 +1310,19 @@ func (c *Client) RPCCall(methodName string,
 		return nil, err, nil
 	}
 
-	_, pval, perr, pfault := Unmarshal(r.Body)
-
-	if r.Close {
-		r.Body.Close()
+	var pval interface{}
+	var perr error
+	var pfault *Fault
+	r.Body = &countingBody{ReadCloser: r.Body, n: &st.respSize}
+	if c.strict {
+		_, pval, perr, pfault = UnmarshalStrict(r.Body)
+	} else {
+		_, pval, perr, pfault = Unmarshal(r.Body)
 	}
 
+	// always close, or the connection can't be reused by the
+	// many parallel calls that Go allows
+	r.Body.Close()
+
 	return pval, perr, pfault
 }
@@ -329,7 +329,16 @@ func XXXTestParseResponseArray(t *testing.T) {
 func TestParseResponseBase64(t *testing.T) {
 	tnm := "base64"
 	val := "eW91IGNhbid0IHJlYWQgdGhpcyE"
-	parseUnimplemented(t, "", []byte(fmt.Sprintf("<%s>%v</%s>", tnm, val, tnm)))
+	xmlStr := wrapMethod("", []byte(fmt.Sprintf("<%s>%v</%s>", tnm, val, tnm)))
+	parseAndCheck(t, "", []byte("you can't read this!"), xmlStr)
+}
+
+func TestMakeRequestBase64(t *testing.T) {
+	xmlStr, err := marshalString("foo", []byte("you can't read this!"))
+	if err != nil {
+		t.Fatalf("Returned error %s", err)
+	}
+	parseAndCheck(t, "foo", []byte("you can't read this!"), xmlStr)
 }
 
 func TestParseResponseBool(t *testing.T) {
@@ -391,6 +400,73 @@ func TestParseResponseFault(t *testing.T) {
 	}
 }
 
+func TestParseResponseFaultTolerant(t *testing.T) {
+	tests := []struct {
+		value string
+		fault Fault
+	}{
+		{`<struct>
+<member><name>faultCode</name><value><string>42</string></value></member>
+<member><name>faultString</name><value>oops</value></member>
+</struct>`, Fault{Code: 42, Msg: "oops"}},
+		{`<struct>
+<member><name>faultCode</name><value><double>3.0</double></value></member>
+<member><name>faultString</name><value><int>7</int></value></member>
+<member><name>trace</name><value>at line 3</value></member>
+</struct>`, Fault{Code: 3, Msg: "7", extra: &faultExtra{
+			members: map[string]interface{}{"trace": "at line 3"}}}},
+		{`<struct>
+<member><name>faultCode</name><value>SERVER_ERROR</value></member>
+</struct>`, Fault{extra: &faultExtra{
+			members: map[string]interface{}{"faultCode": "SERVER_ERROR"}}}},
+		{`<string>no struct at all</string>`, Fault{Msg: "no struct at all"}},
+		{`<int>500</int>`, Fault{Msg: "500"}},
+	}
+
+	for _, tt := range tests {
+		xmlStr := "<methodResponse>\n<fault>\n<value>" + tt.value +
+			"</value>\n</fault>\n</methodResponse>"
+		_, _, err, fault := UnmarshalString(xmlStr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(fault, &tt.fault) {
+			t.Errorf("%s: got %#v, expected %#v", tt.value, fault, &tt.fault)
+		}
+
+		compact := strings.Replace(xmlStr, "\n", "", -1)
+		_, _, err, fault = UnmarshalString(compact)
+		if err != nil || !reflect.DeepEqual(fault, &tt.fault) {
+			t.Errorf("compact %s: got %#v, %v", tt.value, fault, err)
+		}
+
+		// the Value decoder agrees
+		_, _, err, fault = NewDecoder(strings.NewReader(xmlStr)).Decode()
+		if err != nil || !reflect.DeepEqual(fault, &tt.fault) {
+			t.Errorf("Decode %s: got %#v, %v", tt.value, fault, err)
+		}
+	}
+}
+
+func TestFaultExtra(t *testing.T) {
+	_, _, _, f := UnmarshalString(`<methodResponse><fault><value><struct>` +
+		`<member><name>faultCode</name><value><int>4</int></value></member>` +
+		`<member><name>id</name><value>e-17</value></member>` +
+		`</struct></value></fault></methodResponse>`)
+	if f == nil || f.Code != 4 || f.Extra()["id"] != "e-17" {
+		t.Fatalf("got %#v", f)
+	}
+	if NewFault(4, "").Extra() != nil || (*Fault)(nil).Extra() != nil {
+		t.Error("expected no extra members")
+	}
+
+	// Faults stay comparable, and usable as map keys
+	seen := map[Fault]bool{*NewFault(1, "x"): true}
+	if !seen[Fault{Code: 1, Msg: "x"}] || *f == *NewFault(4, "") {
+		t.Error("comparison failed")
+	}
+}
+
 func TestParseResponseInt(t *testing.T) {
 	wrapAndParse(t, "", 1279905716)
 }
@@ -584,3 +660,76 @@ func TestParseCallNewLine(t *testing.T) {
 }
 
 
+
+
+type keyColor int
+
+func (c keyColor) MarshalText() ([]byte, error) {
+	return []byte([]string{"red", "green"}[c]), nil
+}
+
+func (c *keyColor) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "red":
+		*c = 0
+	case "green":
+		*c = 1
+	default:
+		return fmt.Errorf("bad color %q", b)
+	}
+	return nil
+}
+
+type keyName string
+
+func TestMarshalMapKeys(t *testing.T) {
+	tests := []struct {
+		m   interface{}
+		exp string
+	}{
+		{map[int]string{-3: "a", 10: "b"},
+			`<struct><member><name>-3</name><value><string>a</string></value></member>` +
+				`<member><name>10</name><value><string>b</string></value></member></struct>`},
+		{map[uint8]int{7: 1},
+			`<struct><member><name>7</name><value><int>1</int></value></member></struct>`},
+		{map[keyName]int{"a<b&c": 1},
+			`<struct><member><name>a&lt;b&amp;c</name><value><int>1</int></value></member></struct>`},
+		{map[keyColor]bool{1: true, 0: false},
+			`<struct><member><name>green</name><value><boolean>1</boolean></value></member>` +
+				`<member><name>red</name><value><boolean>0</boolean></value></member></struct>`},
+	}
+
+	e := &Encoder{Format: FormatCanonical}
+	for _, tt := range tests {
+		buf := bytes.NewBufferString("")
+		if err := e.Marshal(buf, "", tt.m); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		got = got[strings.Index(got, "<value>")+7 : strings.LastIndex(got, "</value>")]
+		if got != tt.exp {
+			t.Errorf("%#v: got\n%s\nexpected\n%s", tt.m, got, tt.exp)
+		}
+
+		// and back again
+		_, params, err, _ := Unmarshal(bytes.NewBufferString(buf.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		back := reflect.New(reflect.TypeOf(tt.m))
+		if err = Assign(back.Interface(), params.([]interface{})[0]); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back.Elem().Interface(), tt.m) {
+			t.Errorf("got back %#v, expected %#v", back.Elem().Interface(), tt.m)
+		}
+	}
+
+	if err := Marshal(bytes.NewBufferString(""), "", map[float64]int{1.5: 1}); err == nil {
+		t.Error("float keys should fail")
+	}
+	var m map[int]int
+	if err := Assign(&m, map[string]interface{}{"x": 1}); err == nil {
+		t.Error("bad int key should fail")
+	}
+}
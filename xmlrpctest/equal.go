@@ -0,0 +1,67 @@
+package xmlrpctest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xmlrpc"
+)
+
+// EqualXML reports whether two XML-RPC documents say the same: the same
+// method name, or both are responses, and params or faults with equal
+// values. Whitespace between elements, the order of struct members and
+// the choice between equivalent forms, such as <i4> and <int>, do not
+// matter.
+func EqualXML(a, b string) (bool, error) {
+	ma, err := decode(a)
+	if err != nil {
+		return false, err
+	}
+	mb, err := decode(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(ma, mb), nil
+}
+
+// AssertEqualXML reports to t when got and want differ as for EqualXML
+func AssertEqualXML(t testing.TB, got, want string) {
+	t.Helper()
+	ok, err := EqualXML(got, want)
+	if err != nil {
+		t.Errorf("xmlrpctest: %v", err)
+	} else if !ok {
+		t.Errorf("xmlrpctest: documents differ\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// what a document says, in a form reflect.DeepEqual can compare
+type message struct {
+	methodName string
+	response   bool
+	params     []interface{}
+	fault      interface{}
+}
+
+func decode(doc string) (*message, error) {
+	m, err := xmlrpc.UnmarshalValue(strings.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+	msg := &message{methodName: m.MethodName, response: m.Response}
+	for i, p := range m.Params {
+		v, err := p.Interface()
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %v", i, err)
+		}
+		msg.params = append(msg.params, v)
+	}
+	if m.Fault != nil {
+		if msg.fault, err = m.Fault.Interface(); err != nil {
+			return nil, fmt.Errorf("fault: %v", err)
+		}
+	}
+	return msg, nil
+}
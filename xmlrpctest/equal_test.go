@@ -0,0 +1,42 @@
+package xmlrpctest
+
+import (
+	"testing"
+)
+
+func TestEqualXML(t *testing.T) {
+	a := `<?xml version="1.0"?>
+<methodCall>
+  <methodName>move</methodName>
+  <params>
+    <param><value><struct>
+      <member><name>x</name><value><i4>1</i4></value></member>
+      <member><name>y</name><value><double>2.5</double></value></member>
+    </struct></value></param>
+    <param><value>plain</value></param>
+  </params>
+</methodCall>`
+	b := `<methodCall><methodName>move</methodName><params><param><value>` +
+		`<struct><member><name>y</name><value><double>2.50</double></value>` +
+		`</member><member><name>x</name><value><int>1</int></value></member>` +
+		`</struct></value></param><param><value><string>plain</string></value>` +
+		`</param></params></methodCall>`
+	AssertEqualXML(t, a, b)
+
+	for _, other := range []string{
+		`<methodCall><methodName>stay</methodName><params/></methodCall>`,
+		`<methodResponse><params><param><value>plain</value></param></params></methodResponse>`,
+		`<methodCall><methodName>move</methodName><params><param><value>` +
+			`<struct><member><name>x</name><value><int>2</int></value></member>` +
+			`<member><name>y</name><value><double>2.5</double></value></member>` +
+			`</struct></value></param><param><value>plain</value></param></params></methodCall>`,
+	} {
+		if ok, err := EqualXML(a, other); ok || err != nil {
+			t.Errorf("%s: got %v, %v", other, ok, err)
+		}
+	}
+
+	if _, err := EqualXML(a, "<methodCall>"); err == nil {
+		t.Error("expected an error for a broken document")
+	}
+}
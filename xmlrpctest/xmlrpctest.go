@@ -0,0 +1,288 @@
+// Package xmlrpctest provides a mock XML-RPC server for testing code
+// which uses xmlrpc.Client, and helpers comparing XML-RPC documents.
+//
+//	s := xmlrpctest.NewServer(t)
+//	s.Expect("add", 1, xmlrpctest.Any()).Return(3)
+//	s.Expect("fail").ReturnFault(4, "Too many parameters")
+//	... code under test calling s.URL, or s.Client() ...
+//	s.Check()
+package xmlrpctest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"xmlrpc"
+)
+
+// fault code of the calls no expectation matches
+const faultUnexpected = -32601
+
+// Server is a mock XML-RPC server, which answers the calls it is told to
+// expect
+type Server struct {
+	URL string
+
+	t       testing.TB
+	srv     *httptest.Server
+	mu      sync.Mutex
+	expects []*Expectation
+	calls   []Call
+}
+
+// Call is a call received by a Server
+type Call struct {
+	Method     string
+	Params     []interface{} // as decoded by xmlrpc.Unmarshal
+	Unexpected bool          // no expectation matched it
+}
+
+// NewServer starts a Server, which is closed when the test ends.
+// Unexpected calls get a fault, and are reported to t by Check.
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client calling the server
+func (s *Server) Client() *xmlrpc.Client {
+	c, err := xmlrpc.NewClient(s.URL)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return c
+}
+
+// Calls returns the calls received so far, in order
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Expect adds an expected call of method with params, which are
+// Matchers or values compared with Eq. It is expected once, unless Times
+// or AnyTimes say otherwise, and answered with an empty response unless
+// Return or ReturnFault say otherwise. The first expectation matching a
+// call, and not used up, answers it. Params which cannot be sent over
+// XML-RPC are reported to t.
+func (s *Server) Expect(method string, params ...interface{}) *Expectation {
+	s.t.Helper()
+	e := &Expectation{method: method, times: 1}
+	for i, p := range params {
+		m, ok := p.(Matcher)
+		if !ok {
+			m = Eq(p)
+		}
+		if em, ok := m.(eqMatcher); ok && em.err != nil {
+			s.t.Errorf("xmlrpctest: param %d of %s: %v", i, method, em.err)
+		}
+		e.params = append(e.params, m)
+	}
+	s.mu.Lock()
+	s.expects = append(s.expects, e)
+	s.mu.Unlock()
+	return e
+}
+
+// Check reports the expectations which did not get all their calls, and
+// the calls which were not expected
+func (s *Server) Check() {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.expects {
+		if e.times >= 0 && e.calls < e.times {
+			s.t.Errorf("xmlrpctest: expected %s %d times, got %d calls", e,
+				e.times, e.calls)
+		}
+	}
+	for _, c := range s.calls {
+		if c.Unexpected {
+			s.t.Errorf("xmlrpctest: unexpected call %s%s", c.Method,
+				formatParams(c.Params))
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	method, params, err, _ := xmlrpc.Unmarshal(req.Body)
+	if err != nil {
+		s.t.Errorf("xmlrpctest: bad call: %v", err)
+		writeFault(resp, -32700, err.Error())
+		return
+	}
+	args, _ := params.([]interface{})
+
+	s.mu.Lock()
+	var match *Expectation
+	for _, e := range s.expects {
+		if (e.times < 0 || e.calls < e.times) && e.matches(method, args) {
+			match = e
+			e.calls++
+			break
+		}
+	}
+	s.calls = append(s.calls, Call{Method: method, Params: args,
+		Unexpected: match == nil})
+	s.mu.Unlock()
+
+	if match == nil {
+		writeFault(resp, faultUnexpected,
+			fmt.Sprintf("Unexpected call %s%s", method, formatParams(args)))
+		return
+	}
+	if match.fault != nil {
+		writeFault(resp, match.fault.Code, match.fault.Msg)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/xml")
+	if err := xmlrpc.Marshal(resp, "", match.results...); err != nil {
+		s.t.Errorf("xmlrpctest: cannot write the results of %s: %v", match, err)
+	}
+}
+
+func writeFault(w io.Writer, code int, msg string) {
+	fault := xmlrpc.NewStruct().
+		Set("faultCode", xmlrpc.NewInt(code)).
+		Set("faultString", xmlrpc.NewString(msg))
+	xmlrpc.MarshalMessage(w, &xmlrpc.Message{Response: true, Fault: fault})
+}
+
+func formatParams(params []interface{}) string {
+	s := make([]string, len(params))
+	for i, p := range params {
+		s[i] = fmt.Sprintf("%#v", p)
+	}
+	return "(" + strings.Join(s, ", ") + ")"
+}
+
+// Expectation is a call a Server expects
+type Expectation struct {
+	method  string
+	params  []Matcher
+	results []interface{}
+	fault   *xmlrpc.Fault
+	times   int // -1 for any number
+	calls   int
+}
+
+// Return sets the results sent back
+func (e *Expectation) Return(results ...interface{}) *Expectation {
+	e.results = results
+	return e
+}
+
+// ReturnFault makes the call get a fault
+func (e *Expectation) ReturnFault(code int, msg string) *Expectation {
+	e.fault = xmlrpc.NewFault(code, msg)
+	return e
+}
+
+// Times sets how many calls are expected
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes lets the call be made any number of times, including none
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+func (e *Expectation) matches(method string, params []interface{}) bool {
+	if method != e.method || len(params) != len(e.params) {
+		return false
+	}
+	for i, m := range e.params {
+		if !m.Match(params[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	s := make([]string, len(e.params))
+	for i, m := range e.params {
+		s[i] = m.String()
+	}
+	return e.method + "(" + strings.Join(s, ", ") + ")"
+}
+
+// Matcher matches a param of a call, as decoded by xmlrpc.Unmarshal
+type Matcher interface {
+	Match(param interface{}) bool
+	String() string
+}
+
+type anyMatcher struct{}
+
+func (anyMatcher) Match(interface{}) bool { return true }
+func (anyMatcher) String() string         { return "any" }
+
+// Any matches any param
+func Any() Matcher {
+	return anyMatcher{}
+}
+
+type eqMatcher struct {
+	v   interface{}
+	err error
+}
+
+func (m eqMatcher) Match(param interface{}) bool {
+	return m.err == nil && reflect.DeepEqual(m.v, param)
+}
+
+func (m eqMatcher) String() string {
+	if m.err != nil {
+		return fmt.Sprintf("%#v (%v)", m.v, m.err)
+	}
+	return fmt.Sprintf("%#v", m.v)
+}
+
+// Eq matches a param equal to v once sent over XML-RPC, so that an int64
+// matches an int, or a Go struct the struct members. It matches nothing
+// when v cannot be sent, Server.Expect reports it.
+func Eq(v interface{}) Matcher {
+	var buf bytes.Buffer
+	if err := xmlrpc.Marshal(&buf, "", v); err != nil {
+		return eqMatcher{v: v, err: err}
+	}
+	_, params, err, _ := xmlrpc.Unmarshal(&buf)
+	if err != nil {
+		return eqMatcher{v: v, err: err}
+	}
+	return eqMatcher{v: params.([]interface{})[0]}
+}
+
+type funcMatcher struct {
+	f    func(interface{}) bool
+	desc string
+}
+
+func (m funcMatcher) Match(param interface{}) bool { return m.f(param) }
+func (m funcMatcher) String() string               { return m.desc }
+
+// Func matches the params for which f is true, desc describes them in
+// failure messages
+func Func(desc string, f func(param interface{}) bool) Matcher {
+	return funcMatcher{f: f, desc: desc}
+}
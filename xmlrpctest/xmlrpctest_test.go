@@ -0,0 +1,103 @@
+package xmlrpctest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collects the errors instead of failing the test
+type recordT struct {
+	testing.TB
+	mu   sync.Mutex
+	errs []string
+}
+
+func (t *recordT) Helper() {}
+
+func (t *recordT) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+	t.mu.Unlock()
+}
+
+type point struct {
+	X, Y int64
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(t)
+	s.Expect("add", 1, Any()).Return(3)
+	s.Expect("move", point{1, 2}).Return(true).Times(2)
+	s.Expect("fail").ReturnFault(4, "Too many parameters")
+	s.Expect("ping", Func("a date", func(p interface{}) bool {
+		_, ok := p.(time.Time)
+		return ok
+	})).AnyTimes()
+
+	c := s.Client()
+	res, err, f := c.RPCCall("add", 1, "x")
+	if err != nil || f != nil || res.([]interface{})[0] != 3 {
+		t.Errorf("add: %v, %v, %v", res, err, f)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, f := c.RPCCall("move", map[string]int{"Y": 2, "X": 1}); f != nil {
+			t.Errorf("move: %v", f)
+		}
+	}
+	if _, _, f := c.RPCCall("fail"); f == nil || f.Code != 4 ||
+		f.Msg != "Too many parameters" {
+		t.Errorf("fail: %v", f)
+	}
+	c.RPCCall("ping", time.Now())
+	s.Check()
+
+	calls := s.Calls()
+	if len(calls) != 5 || calls[0].Method != "add" ||
+		calls[0].Params[1] != "x" || calls[4].Unexpected {
+		t.Errorf("calls %+v", calls)
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	rt := &recordT{TB: t}
+	s := NewServer(rt)
+	s.Expect("add", 1, 2).Return(3)
+	s.Expect("twice").Times(2)
+
+	c := s.Client()
+	_, _, f := c.RPCCall("add", 1, 3)
+	if f == nil || f.Code != faultUnexpected {
+		t.Errorf("got %v", f)
+	}
+	c.RPCCall("twice")
+	c.RPCCall("twice")
+	c.RPCCall("twice")
+	s.Check()
+
+	exp := []string{
+		"xmlrpctest: expected add(1, 2) 1 times, got 0 calls",
+		"xmlrpctest: unexpected call add(1, 3)",
+		"xmlrpctest: unexpected call twice()",
+	}
+	if strings.Join(rt.errs, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("got\n%s", strings.Join(rt.errs, "\n"))
+	}
+}
+
+func TestServerEqError(t *testing.T) {
+	rt := &recordT{TB: t}
+	s := NewServer(rt)
+	e := s.Expect("send", make(chan int))
+	if len(rt.errs) != 1 || !strings.HasPrefix(rt.errs[0],
+		"xmlrpctest: param 0 of send: ") {
+		t.Fatalf("got %q", rt.errs)
+	}
+	// the error is in the failure messages too
+	if str := e.String(); !strings.HasPrefix(str, "send((chan int)(") ||
+		!strings.Contains(str, "(Not wrapping type chan") {
+		t.Errorf("got %s", str)
+	}
+}